@@ -0,0 +1,91 @@
+package bump
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	TypeJSON  = "json"
+	TypeYAML  = "yaml"
+	TypeRegex = "regex"
+	TypeGo    = "go"
+
+	defaultGoVariable = "Version"
+	defaultKey        = "version"
+)
+
+// Updater rewrites the version string in the content of a file.
+type Updater interface {
+	Update(content, version string) (string, error)
+}
+
+// New returns an updater of the type.
+// key is the dotted path of json and yaml files or the variable name of go files,
+// pattern is a regular expression whose first group is replaced by the version.
+func New(kind, key, pattern string) (Updater, error) {
+	switch kind {
+	case TypeJSON:
+		if key == "" {
+			key = defaultKey
+		}
+		return &jsonUpdater{path: strings.Split(key, ".")}, nil
+	case TypeYAML:
+		if key == "" {
+			key = defaultKey
+		}
+		return &yamlUpdater{path: strings.Split(key, ".")}, nil
+	case TypeGo:
+		if key == "" {
+			key = defaultGoVariable
+		}
+		pattern = fmt.Sprintf(`(?m)^\s*(?:var\s+)?%s(?:\s+string)?\s*=\s*"([^"]*)"`, regexp.QuoteMeta(key))
+		return newRegexUpdater(pattern)
+	case TypeRegex:
+		return newRegexUpdater(pattern)
+	default:
+		return nil, fmt.Errorf("unknown version file type %q", kind)
+	}
+}
+
+// DetectType guesses the updater type by the file name.
+func DetectType(path string) string {
+	switch {
+	case strings.HasSuffix(path, ".json"):
+		return TypeJSON
+	case strings.HasSuffix(path, ".yaml"), strings.HasSuffix(path, ".yml"):
+		return TypeYAML
+	case strings.HasSuffix(path, ".go"):
+		return TypeGo
+	default:
+		return TypeRegex
+	}
+}
+
+type regexUpdater struct {
+	re *regexp.Regexp
+}
+
+func newRegexUpdater(pattern string) (*regexUpdater, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("pattern %q has no group to be replaced", pattern)
+	}
+	return &regexUpdater{re: re}, nil
+}
+
+// Update replaces the first group of the first match.
+func (u *regexUpdater) Update(content, version string) (string, error) {
+	loc := u.re.FindStringSubmatchIndex(content)
+	if loc == nil || loc[2] < 0 {
+		return "", fmt.Errorf("no version matches %q", u.re.String())
+	}
+	return content[:loc[2]] + version + content[loc[3]:], nil
+}
@@ -0,0 +1,57 @@
+package bump
+
+import "testing"
+
+func TestUpdate(t *testing.T) {
+	testcases := []struct {
+		kind, key, pattern string
+		content            string
+		expected           string
+	}{
+		{
+			TypeJSON, "", "",
+			"{\n  \"name\": \"web\",\n  \"deps\": {\"version\": \"1\"},\n  \"version\": \"1.0.0\"\n}\n",
+			"{\n  \"name\": \"web\",\n  \"deps\": {\"version\": \"1\"},\n  \"version\": \"1.2.0\"\n}\n",
+		},
+		{
+			TypeJSON, "a.version", "",
+			`{"version": "0.1.0", "a": {"list": [{"version": "x"}], "version" : "1.0.0"}}`,
+			`{"version": "0.1.0", "a": {"list": [{"version": "x"}], "version" : "1.2.0"}}`,
+		},
+		{
+			TypeYAML, "appVersion", "",
+			"apiVersion: v2\nversion: 0.1.0\nappVersion: \"1.0.0\" # app\n",
+			"apiVersion: v2\nversion: 0.1.0\nappVersion: \"1.2.0\" # app\n",
+		},
+		{
+			TypeYAML, "image.version", "",
+			"version: 0.1.0\nimage:\n  name: web\n  version: 1.0.0\n",
+			"version: 0.1.0\nimage:\n  name: web\n  version: 1.2.0\n",
+		},
+		{
+			TypeGo, "", "",
+			"package build\n\nvar Version = \"DEV\"\n\nvar Date = \"\"\n",
+			"package build\n\nvar Version = \"1.2.0\"\n\nvar Date = \"\"\n",
+		},
+		{
+			TypeRegex, "", `<artifactId>app</artifactId>\s*<version>([^<]*)</version>`,
+			"<parent><version>2.0</version></parent>\n<artifactId>app</artifactId>\n<version>1.0.0</version>",
+			"<parent><version>2.0</version></parent>\n<artifactId>app</artifactId>\n<version>1.2.0</version>",
+		},
+	}
+
+	for i, tc := range testcases {
+		u, err := New(tc.kind, tc.key, tc.pattern)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		result, err := u.Update(tc.content, "1.2.0")
+		if err != nil {
+			t.Errorf("case %d: %v", i, err)
+			continue
+		}
+		if result != tc.expected {
+			t.Errorf("failed to assert equal case %d of \n%s and \n%s", i, result, tc.expected)
+		}
+	}
+}
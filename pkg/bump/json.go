@@ -0,0 +1,86 @@
+package bump
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// jsonUpdater replaces a string value in place, so the formatting and key order are kept.
+type jsonUpdater struct {
+	path []string
+}
+
+type jsonScanner struct {
+	dec   *json.Decoder
+	path  []string
+	start int64
+	end   int64
+}
+
+func (u *jsonUpdater) Update(content, version string) (string, error) {
+	s := &jsonScanner{
+		dec:   json.NewDecoder(strings.NewReader(content)),
+		path:  u.path,
+		start: -1,
+	}
+	if err := s.value(0, true); err != nil {
+		return "", err
+	}
+	if s.start < 0 {
+		return "", fmt.Errorf("no string value at %s", strings.Join(u.path, "."))
+	}
+
+	// the range starts after the key, skip the colon and spaces
+	start := s.start + int64(strings.IndexByte(content[s.start:s.end], '"'))
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(version); err != nil {
+		return "", err
+	}
+	return content[:start] + strings.TrimSpace(b.String()) + content[s.end:], nil
+}
+
+// value reads a json value, matched is true if the value is on the path until depth.
+func (s *jsonScanner) value(depth int, matched bool) error {
+	offset := s.dec.InputOffset()
+	t, err := s.dec.Token()
+	if err == io.EOF {
+		return fmt.Errorf("unexpected end of json")
+	}
+	if err != nil {
+		return err
+	}
+	switch t {
+	case json.Delim('{'):
+		for s.dec.More() {
+			kt, err := s.dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := kt.(string)
+			next := matched && depth < len(s.path) && s.path[depth] == key
+			if err = s.value(depth+1, next); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+		return err
+	case json.Delim('['):
+		for s.dec.More() {
+			if err = s.value(depth+1, false); err != nil {
+				return err
+			}
+		}
+		_, err = s.dec.Token()
+		return err
+	}
+	if _, ok := t.(string); ok && matched && depth == len(s.path) && s.start < 0 {
+		s.start = offset
+		s.end = s.dec.InputOffset()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package bump
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var yamlKeyRe = regexp.MustCompile(`^(\s*)([^\s#:][^:#]*?):(\s+)(.*)$`)
+var yamlNestedKeyRe = regexp.MustCompile(`^(\s*)([^\s#:-][^:#]*?):\s*(#.*)?$`)
+
+// yamlUpdater replaces a scalar of block mappings line by line,
+// comments and formatting are kept.
+type yamlUpdater struct {
+	path []string
+}
+
+type yamlKey struct {
+	indent int
+	name   string
+}
+
+func (u *yamlUpdater) Update(content, version string) (string, error) {
+	lines := strings.Split(content, "\n")
+	var stack []yamlKey
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		var indent int
+		var name string
+		m := yamlNestedKeyRe.FindStringSubmatch(line)
+		scalar := yamlKeyRe.FindStringSubmatch(line)
+		switch {
+		case m != nil:
+			indent, name = len(m[1]), unquote(m[2])
+		case scalar != nil:
+			indent, name = len(scalar[1]), unquote(scalar[2])
+		default:
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		stack = append(stack, yamlKey{indent: indent, name: name})
+		if scalar == nil || !u.match(stack) {
+			continue
+		}
+
+		value, comment := splitComment(scalar[4])
+		quote := ""
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') {
+			quote = value[:1]
+		}
+		lines[i] = fmt.Sprintf("%s%s:%s%s%s%s%s", scalar[1], scalar[2], scalar[3], quote, version, quote, comment)
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", fmt.Errorf("no value at %s", strings.Join(u.path, "."))
+}
+
+func (u *yamlUpdater) match(stack []yamlKey) bool {
+	if len(stack) != len(u.path) {
+		return false
+	}
+	for i, k := range stack {
+		if k.name != u.path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func unquote(s string) string {
+	return strings.Trim(s, `"'`)
+}
+
+// splitComment splits the value and the trailing comment including the spaces before it.
+func splitComment(s string) (value, comment string) {
+	if i := strings.Index(s, " #"); i >= 0 {
+		value, comment = s[:i], s[i:]
+	} else {
+		value = s
+	}
+	trimmed := strings.TrimRight(value, " \t")
+	return trimmed, value[len(trimmed):] + comment
+}
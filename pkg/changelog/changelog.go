@@ -1,47 +1,204 @@
 package changelog
 
 import (
-	"bufio"
 	"fmt"
 	"strings"
 	"time"
+
+	"walle/pkg/semver"
 )
 
 var (
 	DateLayout = "2006-01-02"
 )
 
-func GenerateChangelog(tagName, content string, originContent string, date time.Time) (string, error) {
-
-	contentLines := strings.Split(content, "\n")
-	var lines []string
-	skipFlag := false
-	tagExistsFlag := false
-
-	scanner := bufio.NewScanner(strings.NewReader(originContent))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.HasPrefix(line, "# ") {
-			tag := strings.SplitN(line[2:], " ", 2)[0]
-			skipFlag = tag == tagName
-			tagExistsFlag = tagExistsFlag || skipFlag
-			if skipFlag {
-				lines = append(lines, line)
-				lines = append(lines, contentLines...)
-				continue
-			}
+type Format string
+
+const (
+	// FormatWalle writes versions like `# v1.2.0 (2024-01-01)` followed by the release notes.
+	FormatWalle Format = "walle"
+	// FormatKeepAChangelog writes versions like `## [1.2.0] - 2024-01-01` with sections of https://keepachangelog.com.
+	FormatKeepAChangelog Format = "keepachangelog"
+)
+
+// ParseFormat parses the format name, an empty name means detecting the format by the file content.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case "", FormatWalle, FormatKeepAChangelog:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown changelog format %q", name)
+	}
+}
+
+type Order string
+
+const (
+	// OrderSemver keeps versions sorted by semantic versions, the newest first.
+	OrderSemver Order = "semver"
+	// OrderDate keeps versions sorted by the release dates, the newest first.
+	OrderDate Order = "date"
+)
+
+// ParseOrder parses the order name, the default is OrderSemver.
+func ParseOrder(name string) (Order, error) {
+	switch o := Order(strings.ToLower(name)); o {
+	case "":
+		return OrderSemver, nil
+	case OrderSemver, OrderDate:
+		return o, nil
+	default:
+		return "", fmt.Errorf("unknown changelog order %q", name)
+	}
+}
+
+type Options struct {
+	// Format is detected by the existing versions if it is empty.
+	Format Format
+	// Order decides where new versions are inserted, the default is OrderSemver.
+	Order Order
+	// TagPrefix is the prefix of the tags, e.g. `api/`. Versions are written without it.
+	TagPrefix string
+	// ComponentPrefixes are the tag prefixes of the monorepo components. In a shared changelog, where versions are
+	// whole tags like `api/v1.2.0`, only versions of the same component are compared to keep the semver order.
+	ComponentPrefixes []string
+	// RepoURL is the web URL of the project, used to maintain the compare links of Keep a Changelog.
+	RepoURL string
+
+	// vPrefix is true if the tags start with `v`
+	vPrefix bool
+}
+
+// tagName returns the tag of the version written in the changelog.
+func (o Options) tagName(version string) string {
+	if o.vPrefix && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	return o.TagPrefix + version
+}
+
+// splitComponent splits the version into the longest component prefix it starts with and the rest.
+func (o Options) splitComponent(version string) (string, string) {
+	var prefix string
+	for _, p := range o.ComponentPrefixes {
+		if p != "" && len(p) > len(prefix) && strings.HasPrefix(version, p) {
+			prefix = p
+		}
+	}
+	return prefix, version[len(prefix):]
+}
+
+// GenerateChangelog replaces the section of the tag with the release notes,
+// or inserts a new section in the order of versions if the tag does not exist.
+// The `Unreleased` section is renamed to the version, its entries are merged with the release notes.
+func GenerateChangelog(tagName, content string, originContent string, date time.Time, opts Options) (string, error) {
+	doc := Parse(originContent)
+	body := strings.Split(content, "\n")
+	version := strings.TrimPrefix(tagName, opts.TagPrefix)
+	opts.vPrefix = strings.HasPrefix(version, "v")
+
+	format := opts.Format
+	if format == "" {
+		format = FormatWalle
+		if isKeepAChangelog(doc) {
+			format = FormatKeepAChangelog
+		}
+	}
+	if format == FormatKeepAChangelog {
+		version = strings.TrimPrefix(version, "v")
+		if len(doc.Versions) == 0 && len(doc.Preamble) == 0 {
+			doc.Preamble = append([]string{}, kacPreamble...)
+			doc.finalNewline = true
+		}
+	}
+
+	if i := doc.Find(version); i >= 0 {
+		old := doc.Versions[i]
+		if format == FormatKeepAChangelog {
+			doc.Versions[i] = kacVersion(old.Heading, body, nil)
+			updateLinks(doc, opts)
+		} else {
+			doc.Versions[i] = parseVersion(old.Heading, old.Level, body)
+		}
+		return doc.String(), nil
+	}
+
+	var pending *Version
+	if i := doc.Find(unreleased); i >= 0 {
+		pending = doc.Remove(i)
+	}
+
+	dateStr := date.Format(DateLayout)
+	var v *Version
+	if format == FormatKeepAChangelog {
+		v = kacVersion(kacHeading(version, dateStr), body, pending)
+	} else {
+		level := doc.VersionLevel()
+		if level == 0 {
+			level = 1
 		}
-		if skipFlag {
-			continue
+		heading := fmt.Sprintf("%s %s (%s)", strings.Repeat("#", level), version, dateStr)
+		v = parseVersion(heading, level, body)
+		if pending != nil {
+			v.merge(pending)
 		}
-		lines = append(lines, line)
 	}
 
-	if !tagExistsFlag {
-		result := []string{fmt.Sprintf("# %s (%s)", tagName, date.Format(DateLayout))}
-		result = append(result, contentLines...)
-		lines = append(result, lines...)
+	i := insertIndex(doc, version, dateStr, opts)
+	if i > 0 && !doc.Versions[i-1].endsWithBlank() {
+		doc.Versions[i-1].appendLine("")
 	}
+	if i == len(doc.Versions) && doc.finalNewline && len(doc.Links) == 0 {
+		// the file ends with the new version
+		v.trimBlank()
+	}
+	doc.Insert(i, v)
+
+	if format == FormatKeepAChangelog {
+		if pending != nil {
+			doc.Insert(0, parseVersion(pending.Heading, pending.Level, []string{""}))
+		}
+		updateLinks(doc, opts)
+	}
+	return doc.String(), nil
+}
 
-	return strings.Join(lines, "\n"), nil
+// insertIndex returns the index of the new version, after the unreleased section.
+// Versions which have no semantic version or date, or belong to other components, are skipped,
+// the top is used if no versions can be compared.
+func insertIndex(doc *Document, version, date string, opts Options) int {
+	start := 0
+	for start < len(doc.Versions) && strings.EqualFold(doc.Versions[start].Name, unreleased) {
+		start++
+	}
+
+	prefix, version := opts.splitComponent(version)
+	last := -1
+	for i := start; i < len(doc.Versions); i++ {
+		v := doc.Versions[i]
+		if opts.Order == OrderDate {
+			if v.Date == "" {
+				continue
+			}
+			if v.Date <= date {
+				return i
+			}
+		} else {
+			vPrefix, name := opts.splitComponent(v.Name)
+			if vPrefix != prefix {
+				continue
+			}
+			if _, ok := semver.Parse(name); !ok {
+				continue
+			}
+			if semver.Less(name, version) {
+				return i
+			}
+		}
+		last = i
+	}
+	if last >= 0 {
+		return last + 1
+	}
+	return start
 }
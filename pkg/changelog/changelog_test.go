@@ -0,0 +1,164 @@
+package changelog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	testcases := []string{
+		"",
+		"\n",
+		"# v0.1.3 (2020-12-22)\n_New Features:_\n- releasenote: all MRs ([!23](https://example.com/-/merge_requests/23)) @liujie\n\n" +
+			"**Bug Fix:**\n- fix tag\n\n# v0.1.2 (2020-12-21)\nOther:\n- a\n  continued\n- b",
+		"# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n" +
+			"## [Unreleased]\n\n### Added\n\n- new feature\n\n## [1.0.0] - 2024-01-01\n\n### Fixed\n\n- bug\n\n" +
+			"[Unreleased]: https://example.com/compare/v1.0.0...HEAD\n[1.0.0]: https://example.com/tags/v1.0.0\n\n",
+		"# Changelog\n\nNo versions yet\n- but a list\n",
+		"## v1.0.0\n- entry without section\n# Title in the middle\n#### deep heading\n",
+	}
+
+	for i, tc := range testcases {
+		result := Parse(tc).String()
+		if result != tc {
+			t.Errorf("failed to round trip case %d of \n%q and \n%q", i, result, tc)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	doc := Parse("# Changelog\n\n## [Unreleased]\n\n### Added\n\n- a\n- b\n\n## [1.0.0] - 2024-01-01\n\n### Fixed\n\n- c\n\n[1.0.0]: https://example.com\n")
+	if len(doc.Preamble) != 2 || len(doc.Versions) != 2 || len(doc.Links) != 1 {
+		t.Fatalf("unexpected document %+v", doc)
+	}
+	if v := doc.Versions[1]; v.Name != "1.0.0" || v.Date != "2024-01-01" || v.Level != 2 {
+		t.Errorf("unexpected version %+v", v)
+	}
+	added := doc.Versions[0].Section("added")
+	if added == nil || len(added.Entries) != 2 || added.Entries[1].Text() != "b" {
+		t.Errorf("unexpected section %+v", added)
+	}
+	if doc.Find("v1.0.0") != 1 || doc.Find("unreleased") != 0 {
+		t.Errorf("failed to find versions")
+	}
+}
+
+func TestGenerateChangelog(t *testing.T) {
+	date := time.Date(2020, 12, 22, 0, 0, 0, 0, time.UTC)
+	notes := "_New Features:_\n- new\n"
+	testcases := []struct {
+		tag, origin, expected string
+	}{
+		{
+			"v0.2.0",
+			"",
+			"# v0.2.0 (2020-12-22)\n_New Features:_\n- new\n",
+		},
+		{
+			"v0.2.0",
+			"# v0.1.0 (2020-12-19)\nOther:\n- old",
+			"# v0.2.0 (2020-12-22)\n_New Features:_\n- new\n\n# v0.1.0 (2020-12-19)\nOther:\n- old",
+		},
+		{
+			"v0.1.0",
+			"# v0.2.0 (2020-12-22)\nOther:\n- a\n\n# v0.1.0 (2020-12-19)\nOther:\n- old\n",
+			"# v0.2.0 (2020-12-22)\nOther:\n- a\n\n# v0.1.0 (2020-12-19)\n_New Features:_\n- new\n\n",
+		},
+	}
+
+	for i, tc := range testcases {
+		result, err := GenerateChangelog(tc.tag, notes, tc.origin, date, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != tc.expected {
+			t.Errorf("failed to assert equal case %d of \n%q and \n%q", i, result, tc.expected)
+		}
+	}
+}
+
+func TestGenerateKeepAChangelog(t *testing.T) {
+	date := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	notes := "**Bug Fix:**\n- api: fix\n\n_New Features:_\n- first\n- second\n\nOther:\n- other\n"
+	origin := "# Changelog\n\nIntro.\n\n## [Unreleased]\n\n## [1.0.0] - 2024-01-01\n\n### Added\n\n- init\n\n" +
+		"[Unreleased]: https://example.com/p/-/compare/api/v1.0.0...HEAD\n[1.0.0]: https://example.com/p/-/tags/api/v1.0.0\n"
+	expected := "# Changelog\n\nIntro.\n\n## [Unreleased]\n\n" +
+		"## [1.1.0] - 2024-02-01\n\n### Added\n\n- first\n- second\n\n### Changed\n\n- other\n\n### Fixed\n\n- api: fix\n\n" +
+		"## [1.0.0] - 2024-01-01\n\n### Added\n\n- init\n\n" +
+		"[Unreleased]: https://example.com/p/-/compare/api/v1.1.0...HEAD\n" +
+		"[1.1.0]: https://example.com/p/-/compare/api/v1.0.0...api/v1.1.0\n" +
+		"[1.0.0]: https://example.com/p/-/tags/api/v1.0.0\n"
+
+	result, err := GenerateChangelog("api/v1.1.0", notes, origin, date, Options{
+		TagPrefix: "api/",
+		RepoURL:   "https://example.com/p",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("failed to assert equal of \n%s\nand\n%s", result, expected)
+	}
+
+	result, err = GenerateChangelog("v1.0.0", "Other:\n- a\n", "", date, Options{
+		Format:  FormatKeepAChangelog,
+		RepoURL: "https://example.com/p",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = "# Changelog\n\nAll notable changes to this project will be documented in this file.\n\n" +
+		"The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/).\n\n" +
+		"## [1.0.0] - 2024-02-01\n\n### Changed\n\n- a\n\n[1.0.0]: https://example.com/p/-/tags/v1.0.0\n"
+	if result != expected {
+		t.Errorf("failed to assert equal of \n%s\nand\n%s", result, expected)
+	}
+}
+
+func TestGenerateChangelogOrder(t *testing.T) {
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	notes := "Other:\n- new\n"
+	origin := "# v1.4.0 (2024-01-20)\nOther:\n- a\n\n# v1.3.4 (2024-01-10)\nOther:\n- b\n"
+	testcases := []struct {
+		tag      string
+		order    Order
+		origin   string
+		expected string
+	}{
+		{
+			"v1.3.5", OrderSemver, origin,
+			"# v1.4.0 (2024-01-20)\nOther:\n- a\n\n# v1.3.5 (2024-01-15)\nOther:\n- new\n\n# v1.3.4 (2024-01-10)\nOther:\n- b\n",
+		},
+		{
+			"v1.0.0", OrderSemver, origin,
+			"# v1.4.0 (2024-01-20)\nOther:\n- a\n\n# v1.3.4 (2024-01-10)\nOther:\n- b\n\n# v1.0.0 (2024-01-15)\nOther:\n- new\n",
+		},
+		{
+			"v2.0.0", OrderDate, origin,
+			"# v1.4.0 (2024-01-20)\nOther:\n- a\n\n# v2.0.0 (2024-01-15)\nOther:\n- new\n\n# v1.3.4 (2024-01-10)\nOther:\n- b\n",
+		},
+		{
+			// whole component tags are only compared with the same component
+			"api/v2.1.0", OrderSemver, "# api/v2.2.0 (2024-01-20)\nOther:\n- c\n\n" + origin + "\n# api/v2.0.0 (2024-01-01)\nOther:\n- d\n",
+			"# api/v2.2.0 (2024-01-20)\nOther:\n- c\n\n" + origin + "\n# api/v2.1.0 (2024-01-15)\nOther:\n- new\n\n# api/v2.0.0 (2024-01-01)\nOther:\n- d\n",
+		},
+		{
+			"api/v1.0.0", OrderSemver, origin,
+			"# api/v1.0.0 (2024-01-15)\nOther:\n- new\n\n" + origin,
+		},
+		{
+			"v1.5.0", OrderSemver, "# Unreleased\nOther:\n- manual\n- new\n\n_New Features:_\n- feature\n\n" + origin,
+			"# v1.5.0 (2024-01-15)\nOther:\n- new\n- manual\n\n_New Features:_\n- feature\n\n" + origin,
+		},
+	}
+
+	for i, tc := range testcases {
+		result, err := GenerateChangelog(tc.tag, notes, tc.origin, date, Options{Order: tc.order, ComponentPrefixes: []string{"api/"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != tc.expected {
+			t.Errorf("failed to assert equal case %d of \n%q and \n%q", i, result, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package changelog
+
+import (
+	"strings"
+)
+
+// Document is a changelog file parsed into version sections.
+// Every line of the file is kept, so an unmodified document is written back as it was.
+type Document struct {
+	// Preamble are the lines before the first version, e.g. the title and introduction.
+	Preamble []string
+	Versions []*Version
+	// Links are the link reference definitions at the end of the file.
+	Links []*Link
+	// Trailing are the blank lines after the links.
+	Trailing []string
+
+	finalNewline bool
+}
+
+// Version is the section of a released version or the unreleased changes.
+type Version struct {
+	// Heading is the heading line, e.g. `# v1.2.0 (2024-01-01)` or `## [1.2.0] - 2024-01-01`.
+	Heading string
+	Level   int
+	Name    string
+	Date    string
+	// Body are the lines before the first section.
+	Body     []string
+	Sections []*Section
+}
+
+// Section groups the entries of a version by kind, e.g. `### Added` or `_New Features:_`.
+type Section struct {
+	// Heading is the title line, empty for entries listed without a title.
+	Heading string
+	Title   string
+	// Body are the lines before the first entry.
+	Body    []string
+	Entries []*Entry
+}
+
+// Entry is a list item and its continuation lines.
+type Entry struct {
+	Lines []string
+}
+
+// Link is a link reference definition, e.g. `[1.2.0]: https://example.com/compare/v1.1.0...v1.2.0`.
+type Link struct {
+	Label string
+	URL   string
+}
+
+func (d *Document) String() string {
+	var lines []string
+	lines = append(lines, d.Preamble...)
+	for _, v := range d.Versions {
+		lines = append(lines, v.Lines()...)
+	}
+	for _, l := range d.Links {
+		lines = append(lines, l.String())
+	}
+	lines = append(lines, d.Trailing...)
+	s := strings.Join(lines, "\n")
+	if d.finalNewline {
+		s += "\n"
+	}
+	return s
+}
+
+// Find returns the index of the version, the `v` prefix and the case are ignored.
+// -1 is returned if the version does not exist.
+func (d *Document) Find(name string) int {
+	for i, v := range d.Versions {
+		if sameVersion(v.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert inserts the version before the i-th version.
+func (d *Document) Insert(i int, v *Version) {
+	d.Versions = append(d.Versions, nil)
+	copy(d.Versions[i+1:], d.Versions[i:])
+	d.Versions[i] = v
+}
+
+// Remove removes the i-th version and returns it.
+func (d *Document) Remove(i int) *Version {
+	v := d.Versions[i]
+	d.Versions = append(d.Versions[:i], d.Versions[i+1:]...)
+	return v
+}
+
+// VersionLevel returns the heading level of versions, 0 if there is no version.
+func (d *Document) VersionLevel() int {
+	if len(d.Versions) == 0 {
+		return 0
+	}
+	return d.Versions[0].Level
+}
+
+// Link returns the link reference with the label, the case is ignored.
+func (d *Document) Link(label string) *Link {
+	for _, l := range d.Links {
+		if strings.EqualFold(l.Label, label) {
+			return l
+		}
+	}
+	return nil
+}
+
+func sameVersion(a, b string) bool {
+	return strings.EqualFold(strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v"))
+}
+
+func (v *Version) Lines() []string {
+	lines := []string{v.Heading}
+	lines = append(lines, v.Body...)
+	for _, s := range v.Sections {
+		lines = append(lines, s.Lines()...)
+	}
+	return lines
+}
+
+// Section returns the section with the title, the case is ignored.
+func (v *Version) Section(title string) *Section {
+	for _, s := range v.Sections {
+		if strings.EqualFold(s.Title, title) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (s *Section) Lines() []string {
+	var lines []string
+	if s.Heading != "" {
+		lines = append(lines, s.Heading)
+	}
+	lines = append(lines, s.Body...)
+	for _, e := range s.Entries {
+		lines = append(lines, e.Lines...)
+	}
+	return lines
+}
+
+// merge adds the entries of the other version which do not exist in this version.
+func (v *Version) merge(other *Version) {
+	for _, os := range other.Sections {
+		s := v.Section(os.Title)
+		if s == nil {
+			if !v.endsWithBlank() {
+				v.appendLine("")
+			}
+			s = &Section{Heading: os.Heading, Title: os.Title, Body: trimBlank(os.Body)}
+			v.Sections = append(v.Sections, s)
+			s.addEntries(os.Entries)
+			if !v.endsWithBlank() {
+				v.appendLine("")
+			}
+			continue
+		}
+		var entries []*Entry
+		for _, e := range os.Entries {
+			if !s.hasEntry(e.Text()) {
+				entries = append(entries, e)
+			}
+		}
+		s.addEntries(entries)
+	}
+}
+
+// endsWithBlank reports whether the last line of the version is blank.
+func (v *Version) endsWithBlank() bool {
+	lines := v.Lines()
+	return strings.TrimSpace(lines[len(lines)-1]) == ""
+}
+
+// appendLine appends the line to the end of the version.
+func (v *Version) appendLine(l string) {
+	if len(v.Sections) == 0 {
+		v.Body = append(v.Body, l)
+		return
+	}
+	s := v.Sections[len(v.Sections)-1]
+	if len(s.Entries) == 0 {
+		s.Body = append(s.Body, l)
+		return
+	}
+	e := s.Entries[len(s.Entries)-1]
+	e.Lines = append(e.Lines, l)
+}
+
+// trimBlank removes the blank lines at the end of the version.
+func (v *Version) trimBlank() {
+	switch {
+	case len(v.Sections) == 0:
+		v.Body = trimBlank(v.Body)
+	case len(v.Sections[len(v.Sections)-1].Entries) == 0:
+		s := v.Sections[len(v.Sections)-1]
+		s.Body = trimBlank(s.Body)
+	default:
+		s := v.Sections[len(v.Sections)-1]
+		e := s.Entries[len(s.Entries)-1]
+		e.Lines = trimBlank(e.Lines)
+	}
+}
+
+func (s *Section) hasEntry(text string) bool {
+	for _, e := range s.Entries {
+		if e.Text() == text {
+			return true
+		}
+	}
+	return false
+}
+
+// addEntries appends the entries before the blank lines at the end of the section.
+func (s *Section) addEntries(entries []*Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	var blank []string
+	if n := len(s.Entries); n > 0 {
+		last := s.Entries[n-1]
+		trimmed := trimBlank(last.Lines)
+		blank = last.Lines[len(trimmed):]
+		last.Lines = trimmed
+	}
+	for _, e := range entries {
+		s.Entries = append(s.Entries, &Entry{Lines: trimBlank(e.Lines)})
+	}
+	last := s.Entries[len(s.Entries)-1]
+	last.Lines = append(last.Lines, blank...)
+}
+
+func trimBlank(lines []string) []string {
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return lines[:end]
+}
+
+// Text returns the first line of the entry without the list marker.
+func (e *Entry) Text() string {
+	if len(e.Lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(e.Lines[0][1:])
+}
+
+func (l *Link) String() string {
+	return "[" + l.Label + "]: " + l.URL
+}
@@ -0,0 +1,164 @@
+package changelog
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	kacAdded      = "Added"
+	kacChanged    = "Changed"
+	kacDeprecated = "Deprecated"
+	kacRemoved    = "Removed"
+	kacFixed      = "Fixed"
+	kacSecurity   = "Security"
+)
+
+var (
+	kacTitles = []string{kacAdded, kacChanged, kacDeprecated, kacRemoved, kacFixed, kacSecurity}
+	// kacKinds maps the section titles of release notes to Keep a Changelog, others are Changed.
+	kacKinds = map[string]string{
+		"new features":  kacAdded,
+		"features":      kacAdded,
+		"added":         kacAdded,
+		"changes":       kacChanged,
+		"changed":       kacChanged,
+		"documentation": kacChanged,
+		"other":         kacChanged,
+		"deprecated":    kacDeprecated,
+		"removed":       kacRemoved,
+		"bug fix":       kacFixed,
+		"bug fixes":     kacFixed,
+		"fixed":         kacFixed,
+		"security":      kacSecurity,
+	}
+
+	kacPreamble = []string{
+		"# Changelog",
+		"",
+		"All notable changes to this project will be documented in this file.",
+		"",
+		"The format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/).",
+		"",
+	}
+)
+
+// isKeepAChangelog reports whether the versions are written like `## [1.2.0] - 2024-01-01`.
+func isKeepAChangelog(doc *Document) bool {
+	for _, v := range doc.Versions {
+		if strings.Contains(v.Heading, "["+v.Name+"]") {
+			return true
+		}
+	}
+	return false
+}
+
+func kacHeading(name, date string) string {
+	if date == "" {
+		return fmt.Sprintf("## [%s]", name)
+	}
+	return fmt.Sprintf("## [%s] - %s", name, date)
+}
+
+// kacVersion converts the release notes into Keep a Changelog sections,
+// the entries of the pending version which are not in the release notes are kept.
+func kacVersion(heading string, notes []string, pending *Version) *Version {
+	parsed := parseVersion("# notes", 1, notes)
+	entries := map[string][]*Entry{}
+	texts := map[string]bool{}
+	add := func(v *Version) {
+		for _, s := range v.Sections {
+			kind, ok := kacKinds[strings.ToLower(s.Title)]
+			if !ok {
+				kind = kacChanged
+			}
+			for _, e := range s.Entries {
+				if texts[e.Text()] {
+					continue
+				}
+				texts[e.Text()] = true
+				entries[kind] = append(entries[kind], &Entry{Lines: trimBlank(e.Lines)})
+			}
+		}
+	}
+	add(parsed)
+	if pending != nil {
+		add(pending)
+	}
+
+	v := parseVersion(heading, 2, []string{""})
+	for _, title := range kacTitles {
+		es, ok := entries[title]
+		if !ok {
+			continue
+		}
+		v.Sections = append(v.Sections, &Section{
+			Heading: "### " + title,
+			Title:   title,
+			Body:    []string{""},
+			Entries: es,
+		})
+		last := es[len(es)-1]
+		last.Lines = append(last.Lines, "")
+	}
+	return v
+}
+
+// updateLinks rewrites the compare links of the versions in the order of versions,
+// other link references are kept after them.
+func updateLinks(doc *Document, opts Options) {
+	if opts.RepoURL == "" {
+		return
+	}
+	repoURL := strings.TrimSuffix(opts.RepoURL, "/")
+
+	var links []*Link
+	used := map[*Link]bool{}
+	for i, v := range doc.Versions {
+		var previous *Version
+		for _, p := range doc.Versions[i+1:] {
+			if !strings.EqualFold(p.Name, unreleased) {
+				previous = p
+				break
+			}
+		}
+
+		var url string
+		switch {
+		case strings.EqualFold(v.Name, unreleased) && previous != nil:
+			url = fmt.Sprintf("%s/-/compare/%s...HEAD", repoURL, opts.tagName(previous.Name))
+		case strings.EqualFold(v.Name, unreleased):
+			continue
+		case previous != nil:
+			url = fmt.Sprintf("%s/-/compare/%s...%s", repoURL, opts.tagName(previous.Name), opts.tagName(v.Name))
+		default:
+			url = fmt.Sprintf("%s/-/tags/%s", repoURL, opts.tagName(v.Name))
+		}
+
+		link := doc.Link(v.Name)
+		if link == nil {
+			link = &Link{Label: v.Name}
+		}
+		link.URL = url
+		used[link] = true
+		links = append(links, link)
+	}
+	for _, l := range doc.Links {
+		if !used[l] {
+			links = append(links, l)
+		}
+	}
+	if len(doc.Links) == 0 && len(links) > 0 && !endsWithBlank(doc) {
+		// separate the links from the last version
+		last := doc.Versions[len(doc.Versions)-1]
+		last.appendLine("")
+	}
+	doc.Links = links
+}
+
+func endsWithBlank(doc *Document) bool {
+	if len(doc.Versions) == 0 {
+		return true
+	}
+	return doc.Versions[len(doc.Versions)-1].endsWithBlank()
+}
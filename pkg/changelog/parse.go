@@ -0,0 +1,152 @@
+package changelog
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var (
+	headingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*$`)
+	// titleRe matches section titles written without headings, e.g. `_New Features:_`, `**Bug Fix:**` and `Other:`
+	titleRe = regexp.MustCompile(`^(\*\*|__|_|\*)?([^*_\s-][^*_:]*):(\*\*|__|_|\*)?\s*$`)
+	dateRe  = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	linkRe  = regexp.MustCompile(`^\[([^\]]+)\]: (\S+)$`)
+)
+
+const unreleased = "Unreleased"
+
+// Parse parses the changelog content.
+//
+// The first heading whose first word looks like a version, e.g. `v1.2.0` or `[Unreleased]`,
+// starts the versions and decides their heading level. Deeper headings and titles ending with a colon
+// start sections, list items without indent start entries.
+func Parse(content string) *Document {
+	doc := &Document{}
+	if content == "" {
+		return doc
+	}
+	lines := strings.Split(content, "\n")
+	if lines[len(lines)-1] == "" {
+		doc.finalNewline = true
+		lines = lines[:len(lines)-1]
+	}
+
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	linkStart := end
+	for linkStart > 0 && linkRe.MatchString(lines[linkStart-1]) {
+		linkStart--
+	}
+	if linkStart < end {
+		for _, l := range lines[linkStart:end] {
+			m := linkRe.FindStringSubmatch(l)
+			doc.Links = append(doc.Links, &Link{Label: m[1], URL: m[2]})
+		}
+		doc.Trailing = lines[end:]
+		lines = lines[:linkStart]
+	}
+
+	p := &parser{doc: doc}
+	for _, l := range lines {
+		p.line(l)
+	}
+	return doc
+}
+
+// parseVersion parses the lines of a version section.
+func parseVersion(heading string, level int, body []string) *Version {
+	v := &Version{Heading: heading, Level: level}
+	if m := headingRe.FindStringSubmatch(heading); m != nil {
+		v.Name, v.Date, _ = parseVersionTitle(m[2])
+	}
+	p := &parser{doc: &Document{}, level: level, version: v}
+	for _, l := range body {
+		p.line(l)
+	}
+	return v
+}
+
+type parser struct {
+	doc *Document
+	// level is the heading level of versions, 0 until the first version
+	level   int
+	version *Version
+	section *Section
+	entry   *Entry
+}
+
+func (p *parser) line(l string) {
+	if m := headingRe.FindStringSubmatch(l); m != nil {
+		level := len(m[1])
+		if name, date, ok := parseVersionTitle(m[2]); ok && (p.level == 0 || p.level == level) {
+			p.level = level
+			p.version = &Version{Heading: l, Level: level, Name: name, Date: date}
+			p.section, p.entry = nil, nil
+			p.doc.Versions = append(p.doc.Versions, p.version)
+			return
+		}
+		if p.version != nil && level == p.level+1 {
+			p.startSection(l, m[2])
+			return
+		}
+	} else if m := titleRe.FindStringSubmatch(l); m != nil && p.version != nil && m[1] == m[3] {
+		p.startSection(l, strings.TrimSpace(m[2]))
+		return
+	}
+
+	if p.version != nil && isListItem(l) {
+		if p.section == nil {
+			p.section = &Section{}
+			p.version.Sections = append(p.version.Sections, p.section)
+		}
+		p.entry = &Entry{Lines: []string{l}}
+		p.section.Entries = append(p.section.Entries, p.entry)
+		return
+	}
+
+	switch {
+	case p.entry != nil:
+		p.entry.Lines = append(p.entry.Lines, l)
+	case p.section != nil:
+		p.section.Body = append(p.section.Body, l)
+	case p.version != nil:
+		p.version.Body = append(p.version.Body, l)
+	default:
+		p.doc.Preamble = append(p.doc.Preamble, l)
+	}
+}
+
+func (p *parser) startSection(heading, title string) {
+	p.section = &Section{Heading: heading, Title: title}
+	p.entry = nil
+	p.version.Sections = append(p.version.Sections, p.section)
+}
+
+func isListItem(l string) bool {
+	return len(l) > 1 && strings.ContainsRune("-*+", rune(l[0])) && l[1] == ' '
+}
+
+// parseVersionTitle parses headings like `v1.2.0 (2024-01-01)`, `[1.2.0] - 2024-01-01` and `[Unreleased]`.
+func parseVersionTitle(title string) (name, date string, ok bool) {
+	rest := ""
+	if strings.HasPrefix(title, "[") {
+		i := strings.Index(title, "]")
+		if i < 0 {
+			return "", "", false
+		}
+		name, rest = title[1:i], title[i+1:]
+	} else {
+		fields := strings.SplitN(title, " ", 2)
+		name = fields[0]
+		if len(fields) > 1 {
+			rest = fields[1]
+		}
+	}
+	if !strings.EqualFold(name, unreleased) && strings.IndexFunc(name, unicode.IsDigit) < 0 {
+		return "", "", false
+	}
+	return name, dateRe.FindString(rest), true
+}
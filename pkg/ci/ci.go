@@ -0,0 +1,38 @@
+// Package ci detects the CI job walle is running in, and defaults the settings to its predefined variables.
+// Only GitLab CI is detected. Other CI systems, e.g. GitHub Actions, are not: walle only talks to GitLab,
+// and their variables describe no GitLab host or project, so all settings have to be given by flags or env.
+package ci
+
+import "os"
+
+// ProviderGitLab is the provider of GitLab CI jobs.
+const ProviderGitLab = "gitlab"
+
+// Env is the environment of the CI job walle is running in.
+type Env struct {
+	Provider string
+	// Host is the URL of the GitLab instance, e.g. `https://gitlab.com`.
+	Host string
+	// Project is the path of the project with its namespace.
+	Project string
+	// Ref is the commit SHA of the job.
+	Ref string
+	// Tag is the tag of tag pipelines, empty for branch pipelines.
+	Tag      string
+	JobToken string
+}
+
+// Detect returns the CI environment from the predefined variables, nil if not running in CI.
+func Detect() *Env {
+	if os.Getenv("GITLAB_CI") != "true" {
+		return nil
+	}
+	return &Env{
+		Provider: ProviderGitLab,
+		Host:     os.Getenv("CI_SERVER_URL"),
+		Project:  os.Getenv("CI_PROJECT_PATH"),
+		Ref:      os.Getenv("CI_COMMIT_SHA"),
+		Tag:      os.Getenv("CI_COMMIT_TAG"),
+		JobToken: os.Getenv("CI_JOB_TOKEN"),
+	}
+}
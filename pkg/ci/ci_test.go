@@ -0,0 +1,48 @@
+package ci
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	names := []string{"GITLAB_CI", "CI_SERVER_URL", "CI_PROJECT_PATH", "CI_COMMIT_SHA", "CI_COMMIT_TAG", "CI_JOB_TOKEN"}
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+	}
+
+	testcases := []struct {
+		env  map[string]string
+		want *Env
+	}{
+		{env: map[string]string{}},
+		// GitLab CI is only detected by GITLAB_CI
+		{env: map[string]string{"CI_PROJECT_PATH": "group/app", "CI_JOB_TOKEN": "job"}},
+		{
+			env: map[string]string{"GITLAB_CI": "true", "CI_SERVER_URL": "https://gitlab.example.com", "CI_PROJECT_PATH": "group/app",
+				"CI_COMMIT_SHA": "abc", "CI_COMMIT_TAG": "v1.0.0", "CI_JOB_TOKEN": "job"},
+			want: &Env{Provider: ProviderGitLab, Host: "https://gitlab.example.com", Project: "group/app", Ref: "abc", Tag: "v1.0.0", JobToken: "job"},
+		},
+		// branch pipelines have no tag, the job token may be missing
+		{
+			env:  map[string]string{"GITLAB_CI": "true", "CI_SERVER_URL": "https://gitlab.example.com", "CI_PROJECT_PATH": "group/app", "CI_COMMIT_SHA": "abc"},
+			want: &Env{Provider: ProviderGitLab, Host: "https://gitlab.example.com", Project: "group/app", Ref: "abc"},
+		},
+	}
+	for i, tc := range testcases {
+		for _, name := range names {
+			_ = os.Unsetenv(name)
+		}
+		for name, value := range tc.env {
+			_ = os.Setenv(name, value)
+		}
+		if got := Detect(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("case %d: got %+v, want %+v", i, got, tc.want)
+		}
+	}
+}
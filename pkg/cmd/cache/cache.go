@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"walle/pkg/context"
+	"walle/pkg/gitlab"
+)
+
+func NewCmdCache(ctx *context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "manage the cache of GitLab responses",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "remove the cached GitLab responses",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := ctx.Config.CacheDir
+			if dir == "" {
+				return fmt.Errorf("no cache directory, set --cache-dir, WALLE_CACHE_DIR or cache_dir of the config file")
+			}
+			removed, err := gitlab.ClearCache(dir)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(cmd.OutOrStdout(), "removed %d cached responses from %s\n", removed, dir)
+			return nil
+		},
+	})
+	return cmd
+}
@@ -2,11 +2,16 @@ package changelog
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
 	"strings"
 
 	"github.com/spf13/cobra"
 
+	"walle/pkg/bump"
 	"walle/pkg/changelog"
+	"walle/pkg/ci"
+	"walle/pkg/config"
 	"walle/pkg/context"
 	"walle/pkg/gitlab"
 )
@@ -14,9 +19,13 @@ import (
 func NewCmdChangelog(ctx *context.Context) *cobra.Command {
 	opts := options{
 		client: ctx.GitLabClient,
+		cfg:    ctx.Config,
 		projectF: func() string {
 			return ctx.Project
 		},
+		ciF: func() *ci.Env {
+			return ctx.CI
+		},
 	}
 
 	cmd := &cobra.Command{
@@ -25,100 +34,399 @@ func NewCmdChangelog(ctx *context.Context) *cobra.Command {
 		RunE:  opts.Run,
 	}
 
-	cmd.Flags().StringVar(&opts.ref, "ref", "", "the ref name")
-	cmd.Flags().StringVarP(&opts.tag, "tag", "t", "", "get release note from this tag (required)")
+	cmd.Flags().StringVar(&opts.ref, "ref", "", "the ref to read the changelog from and create the branch on, a branch, tag or commit SHA "+
+		"(required unless --local). default is CI_COMMIT_SHA in GitLab CI")
+	cmd.Flags().StringSliceVarP(&opts.tags, "tag", "t", nil, "get release note from this tag (required unless --rebuild). default is CI_COMMIT_TAG in GitLab CI. "+
+		"Multiple tags of monorepo components update their own changelog files in one MR")
 	cmd.Flags().StringVarP(&opts.branch, "branch", "b", "", "target branch name")
-	cmd.Flags().StringVarP(&opts.filepath, "file", "f", "CHANGELOG.md", "the changelog file path. default is `CHANGELOG.md`")
+	cmd.Flags().StringVarP(&opts.filepath, "file", "f", "CHANGELOG.md", "the changelog file path of tags not belonging to any component. default is `CHANGELOG.md`")
 	cmd.Flags().BoolVar(&opts.merge, "merge", false, "merge automatically")
 	cmd.Flags().IntVar(&opts.AssigneeID, "assignee", 0, "assignee user ID")
-	_ = cmd.MarkFlagRequired("tag")
+	cmd.Flags().StringVar(&opts.format, "format", "", "the changelog format, `walle` or `keepachangelog`. detected by the file content by default")
+	cmd.Flags().StringVar(&opts.order, "order", "", "where new versions are inserted, sorted by `semver` or tag `date`. default is semver")
+	cmd.Flags().BoolVar(&opts.bump, "bump-version", false, "update the version files defined in config file in the same MR")
+	cmd.Flags().BoolVar(&opts.local, "local", false, "read and write the files in the working tree instead of creating a MR")
+	cmd.Flags().BoolVar(&opts.check, "check", false, "exit with an error if the local files are out of date, nothing is written")
+	cmd.Flags().BoolVar(&opts.rebuild, "rebuild", false, "regenerate the whole changelog file from all tags")
+	cmd.Flags().BoolVar(&opts.recompute, "recompute", false, "compute release notes of tags instead of using their releases when rebuilding")
+	cmd.Flags().StringVarP(&opts.component, "component", "c", "", "rebuild the changelog of the component")
+	cmd.Flags().StringVar(&opts.stateFile, "state-file", defaultStateFile, "the file saving rebuild progress to resume from")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "fail the rebuild if any merge request can not be fetched, instead of leaving it out of the release notes")
 
 	return cmd
 }
 
 type options struct {
 	client   gitlab.Client
+	cfg      *config.Config
 	projectF func() string
+	ciF      func() *ci.Env
 	project  string
 	merge    bool
 
 	ref        string
 	branch     string
 	filepath   string
-	tag        string
+	tags       []string
 	AssigneeID int
+	bump       bool
+	format     string
+	order      string
+
+	local     bool
+	check     bool
+	rebuild   bool
+	recompute bool
+	strict    bool
+	component string
+	stateFile string
+
+	genOpts     changelog.Options
+	projectInfo gitlab.Project
+	files       []*repoFile
+}
+
+// repoFile is a file of the repository to be updated.
+type repoFile struct {
+	path    string
+	origin  string
+	content string
+
+	// exists is false if the file will be created
+	exists       bool
+	lastCommitID string
+}
+
+// loadFile returns the file at the ref, the same file is loaded only once.
+func (o *options) loadFile(path string) (*repoFile, error) {
+	for _, f := range o.files {
+		if f.path == path {
+			return f, nil
+		}
+	}
+	file := &repoFile{path: path}
+	if o.local {
+		b, err := ioutil.ReadFile(path)
+		if err == nil {
+			file.exists = true
+			file.origin = string(b)
+			file.content = file.origin
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+		o.files = append(o.files, file)
+		return file, nil
+	}
+	content, err := o.client.GetRepoFile(o.project, path, o.ref)
+	err = gitlab.DescribeError(err, "get file "+path, gitlab.PermissionRead)
+	if err == nil {
+		file.exists = true
+		file.lastCommitID = content.LastCommitID
+		file.origin = content.Content
+		file.content = content.Content
+	} else if err != gitlab.ErrFileNotFound {
+		return nil, err
+	}
+	o.files = append(o.files, file)
+	return file, nil
+}
+
+// changelogOf returns the changelog file of the component, nil for tags not belonging to any component,
+// and the options to write its versions. Versions are written without the tag prefix only to the own changelog
+// file of the component, the shared file keeps the whole tag to tell the components apart.
+func (o *options) changelogOf(com *config.Component) (string, changelog.Options) {
+	genOpts := o.genOpts
+	if com == nil || com.Changelog == "" {
+		return o.filepath, genOpts
+	}
+	genOpts.TagPrefix = com.TagPrefix
+	return com.Changelog, genOpts
+}
+
+// bumpVersion updates the version files to the version.
+func (o *options) bumpVersion(versionFiles []config.VersionFile, version string) error {
+	version = strings.TrimPrefix(version, "v")
+	for _, vf := range versionFiles {
+		kind := vf.Type
+		if kind == "" {
+			kind = bump.DetectType(vf.Path)
+		}
+		updater, err := bump.New(kind, vf.Key, vf.Pattern)
+		if err != nil {
+			return fmt.Errorf("version file %s: %v", vf.Path, err)
+		}
+		file, err := o.loadFile(vf.Path)
+		if err != nil {
+			return err
+		}
+		if !file.exists {
+			return fmt.Errorf("version file %s does not exist", vf.Path)
+		}
+		file.content, err = updater.Update(file.content, vf.Prefix+version)
+		if err != nil {
+			return fmt.Errorf("version file %s: %v", vf.Path, err)
+		}
+	}
+	return nil
 }
 
 func (o *options) Run(cmd *cobra.Command, args []string) (err error) {
 	o.project = o.projectF()
-	tag, err := o.client.GetTag(o.project, o.tag)
-	if err != nil {
-		return
+	if env := o.ciF(); env != nil {
+		if len(o.tags) == 0 && env.Tag != "" {
+			o.tags = []string{env.Tag}
+		}
+		if o.ref == "" {
+			o.ref = env.Ref
+		}
+	}
+	if len(o.tags) == 0 && !o.rebuild {
+		return fmt.Errorf(`required flag(s) "tag" not set`)
 	}
-	if tag.Release == nil {
-		return fmt.Errorf("tag have no any release note")
+	if o.check {
+		o.local = true
+	}
+	if o.ref == "" && !o.local {
+		return fmt.Errorf(`required flag(s) "ref" not set`)
 	}
 
-	fileContent, err := o.client.GetFile(o.project, o.filepath, o.ref)
+	formatName := o.format
+	if formatName == "" {
+		formatName = o.cfg.ChangelogFormat
+	}
+	o.genOpts.Format, err = changelog.ParseFormat(formatName)
 	if err != nil {
 		return
 	}
-
-	newContent, err := changelog.GenerateChangelog(o.tag, tag.Release.Description, fileContent, tag.Commit.CreatedAt)
+	orderName := o.order
+	if orderName == "" {
+		orderName = o.cfg.ChangelogOrder
+	}
+	o.genOpts.Order, err = changelog.ParseOrder(orderName)
 	if err != nil {
 		return
 	}
+	o.projectInfo, err = o.client.GetProject(o.project)
+	if err = gitlab.DescribeError(err, "get project", gitlab.PermissionRead); err != nil {
+		return
+	}
+	o.genOpts.RepoURL = o.projectInfo.WebURL
+	for _, com := range o.cfg.Components {
+		o.genOpts.ComponentPrefixes = append(o.genOpts.ComponentPrefixes, com.TagPrefix)
+	}
 
-	if newContent == fileContent {
-		fmt.Println("nothing have been changed")
-		return nil
+	if o.rebuild {
+		return o.runRebuild(cmd)
 	}
 
-	msg := fmt.Sprintf("docs(changelog): update changelog of %s", o.tag)
+	for _, tagName := range o.tags {
+		tag, err := o.client.GetTag(o.project, tagName)
+		if err != nil {
+			return gitlab.DescribeError(err, "get tag "+tagName, gitlab.PermissionRead)
+		}
+		release, err := o.client.GetRelease(o.project, tagName)
+		if err == gitlab.ErrReleaseNotFound {
+			return fmt.Errorf("tag %s have no any release note", tagName)
+		} else if err != nil {
+			return gitlab.DescribeError(err, "get release "+tagName, gitlab.PermissionRead)
+		}
 
-	branchName := fmt.Sprintf("changelog-%s", o.tag)
-	err = o.client.NewBranch(o.project, branchName, o.ref)
-	if err == nil {
-		// update file content
+		version, versionFiles := tagName, o.cfg.VersionFiles
+		com := o.cfg.ComponentByTag(tagName)
+		if com != nil {
+			version, versionFiles = com.TrimTagPrefix(tagName), com.VersionFiles
+		}
+		path, genOpts := o.changelogOf(com)
 
-		fileReq := gitlab.RepoFileRequest{
-			Branch:        branchName,
-			CommitMessage: msg,
-			Content:       newContent,
+		file, err := o.loadFile(path)
+		if err != nil {
+			return err
 		}
-		err = o.client.UpdateFile(o.project, o.filepath, fileReq)
+		file.content, err = changelog.GenerateChangelog(tagName, release.Description, file.content, tag.Commit.CreatedAt, genOpts)
 		if err != nil {
-			return
+			return err
 		}
-	} else if !strings.Contains(err.Error(), "Branch already exists") {
-		// got an error and it is not "Branch already exists"
-		return
+
+		if o.bump {
+			if err = o.bumpVersion(versionFiles, version); err != nil {
+				return err
+			}
+		}
+	}
+
+	tagNames := strings.Join(o.tags, ", ")
+	msg := fmt.Sprintf("docs(changelog): update changelog of %s", tagNames)
+	if o.bump {
+		msg = fmt.Sprintf("chore(release): bump version and update changelog of %s", tagNames)
+	}
+	branchName := BranchName(o.tags)
+	summary := fmt.Sprintf("Update the changelog of %s.", tagNames)
+	if o.bump {
+		summary = fmt.Sprintf("Bump the version and update the changelog of %s.", tagNames)
+	}
+	return o.submit(branchName, msg, summary)
+}
+
+// BranchName returns the branch the changelog of the tags is committed to.
+func BranchName(tags []string) string {
+	return fmt.Sprintf("changelog-%s", strings.Join(tags, "-"))
+}
+
+// RebuildBranchName returns the branch the rebuilt changelog of the component is committed to,
+// component is empty for the whole repository.
+func RebuildBranchName(component string) string {
+	if component == "" {
+		return "changelog-rebuild"
+	}
+	return fmt.Sprintf("changelog-rebuild-%s", component)
+}
+
+// writeLocal writes the changed files to the working tree, or reports them if checking only.
+func (o *options) writeLocal(changed []*repoFile) error {
+	if len(changed) == 0 {
+		fmt.Println("nothing have been changed")
+		return nil
+	}
+	var paths []string
+	for _, f := range changed {
+		paths = append(paths, f.path)
+		if o.check {
+			continue
+		}
+		if err := ioutil.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("updated %s\n", f.path)
+	}
+	if o.check {
+		return fmt.Errorf("out of date: %s", strings.Join(paths, ", "))
+	}
+	return nil
+}
+
+// submit commits the changed files to a new branch and creates the merge request,
+// the files are written to the working tree instead in local mode.
+// If the branch exists, it is reset to the ref with the changed files, and its open merge request is updated.
+// The merge request is described by summary, it is excluded from release notes.
+func (o *options) submit(branchName, msg, summary string) (err error) {
+	var changed []*repoFile
+	for _, f := range o.files {
+		if f.content != f.origin {
+			changed = append(changed, f)
+		}
+	}
+	if o.local {
+		return o.writeLocal(changed)
+	}
+
+	if len(changed) == 0 {
+		fmt.Println("nothing have been changed")
+		return nil
 	}
 
 	targetBranch := o.branch
 	if targetBranch == "" {
-		p, err := o.client.GetProject(o.project)
+		targetBranch = o.projectInfo.DefaultBranch
+	}
+	description := summary + "\n\n/release-note-none"
+
+	branch, err := o.client.GetBranch(o.project, branchName)
+	if err != nil && err != gitlab.ErrBranchNotFound {
+		return gitlab.DescribeError(err, "get branch "+branchName, gitlab.PermissionRead)
+	}
+
+	var mr *gitlab.MergeRequest
+	if branch != nil {
+		mrs, err := o.client.FindMergeRequests(o.project, gitlab.MergeRequestQuery{
+			State:        "opened",
+			SourceBranch: branchName,
+			TargetBranch: targetBranch,
+		})
 		if err != nil {
-			return err
+			return gitlab.DescribeError(err, "find merge requests", gitlab.PermissionRead)
+		}
+		if len(mrs) > 0 {
+			mr = &mrs[0]
 		}
-		targetBranch = p.DefaultBranch
 	}
 
-	mrReq := gitlab.MergeRequestRequest{
-		SourceBranch:       branchName,
-		TargetBranch:       targetBranch,
-		Title:              msg,
-		Description:        "/release-note-none",
-		RemoveSourceBranch: true,
-		AssigneeID:         o.AssigneeID,
+	if branch == nil {
+		if err = o.client.NewBranch(o.project, branchName, o.ref); err != nil {
+			return gitlab.DescribeError(err, "create branch "+branchName, gitlab.PermissionPush)
+		}
+		// update files content in one commit
+		_, err = o.client.CommitFiles(o.project, gitlab.CommitRequest{
+			Branch:        branchName,
+			CommitMessage: msg,
+			Actions:       commitActions(changed, true),
+		})
+	} else {
+		// the files are generated from the ref, reset the branch left by a previous run, e.g. behind the ref,
+		// to a single commit on top of the ref. The open merge request of the branch is kept.
+		var ref *gitlab.Commit
+		ref, err = o.client.GetCommit(o.project, o.ref)
+		if err != nil {
+			return gitlab.DescribeError(err, "get commit of "+o.ref, gitlab.PermissionRead)
+		}
+		fmt.Printf("reset branch %s to %s\n", branchName, o.ref)
+		_, err = o.client.CommitFiles(o.project, gitlab.CommitRequest{
+			Branch:        branchName,
+			CommitMessage: msg,
+			Actions:       commitActions(changed, false),
+			StartSHA:      ref.ID,
+			Force:         true,
+		})
 	}
-	mr, err := o.client.CreateMergeRequest(o.project, mrReq)
 	if err != nil {
-		return
+		return gitlab.DescribeError(err, "commit to branch "+branchName, gitlab.PermissionPush)
+	}
+
+	if mr == nil {
+		mrReq := gitlab.MergeRequestRequest{
+			SourceBranch:       branchName,
+			TargetBranch:       targetBranch,
+			Title:              msg,
+			Description:        description,
+			RemoveSourceBranch: true,
+			AssigneeID:         o.AssigneeID,
+		}
+		mr, err = o.client.CreateMergeRequest(o.project, mrReq)
+	} else {
+		fmt.Printf("update merge request !%d\n", mr.IID)
+		mr, err = o.client.UpdateMergeRequest(o.project, mr.IID, gitlab.MergeRequestUpdate{
+			Title:       msg,
+			Description: description,
+			AssigneeID:  o.AssigneeID,
+		})
+	}
+	if err != nil {
+		return gitlab.DescribeError(err, "create or update merge request", gitlab.PermissionWrite)
 	}
 
 	if o.merge {
 		_, err = o.client.AcceptMR(o.project, mr.IID)
+		err = gitlab.DescribeError(err, fmt.Sprintf("merge !%d", mr.IID), gitlab.PermissionMerge)
 	}
 	return
 }
+
+// commitActions returns the actions writing the files. The last commits of the files read from the ref
+// guard against concurrent changes, but not for forced commits, GitLab may check them against the old branch.
+func commitActions(files []*repoFile, checkLastCommit bool) []gitlab.CommitAction {
+	var actions []gitlab.CommitAction
+	for _, f := range files {
+		action := gitlab.CommitAction{
+			Action:   gitlab.CommitActionUpdate,
+			FilePath: f.path,
+			Content:  f.content,
+		}
+		if checkLastCommit {
+			action.LastCommitID = f.lastCommitID
+		}
+		if !f.exists {
+			action.Action = gitlab.CommitActionCreate
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
@@ -0,0 +1,347 @@
+package changelog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/config"
+	"walle/pkg/context"
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+const initialChangelog = "# Changelog\n"
+
+// newProject returns a fake GitLab with group/app, which has a changelog and the tag v1.0.0 of a merged merge request.
+func newProject(t *testing.T) (*gitlabtest.Server, *gitlabtest.Project) {
+	s := gitlabtest.NewServer()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Commit("master", "chore: init", map[string]string{"CHANGELOG.md": initialChangelog})
+	p.Merge(gitlab.MergeRequest{Title: "feat: first feature"}, map[string]string{"a.go": "a"})
+	p.Tag("v1.0.0", "master")
+	p.Release("v1.0.0", "_New Features:_\n\n- first feature (!1)")
+	return s, p
+}
+
+// run runs `walle changelog` with the args, stderr is returned.
+func run(t *testing.T, s *gitlabtest.Server, args ...string) (string, error) {
+	return runWithConfig(t, s, &config.Config{}, args...)
+}
+
+func runWithConfig(t *testing.T, s *gitlabtest.Server, cfg *config.Config, args ...string) (string, error) {
+	ctx := context.NewContext(s.Client(), cfg, logrus.NewEntry(logrus.New()))
+	ctx.Project = "group/app"
+	cmd := NewCmdChangelog(&ctx)
+	var stderr bytes.Buffer
+	cmd.SetOut(ioutil.Discard)
+	cmd.SetErr(&stderr)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return stderr.String(), err
+}
+
+func requestsOf(s *gitlabtest.Server, prefix string) []string {
+	var requests []string
+	for _, r := range s.Requests() {
+		if strings.HasPrefix(r, prefix) {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+func TestChangelog(t *testing.T) {
+	s, p := newProject(t)
+	defer s.Close()
+
+	// the first run creates the branch and the merge request
+	if _, err := run(t, s, "-t", "v1.0.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := p.File("changelog-v1.0.0", "CHANGELOG.md")
+	if !strings.Contains(content, "v1.0.0") || !strings.Contains(content, "first feature (!1)") {
+		t.Fatalf("got changelog\n%s", content)
+	}
+	mrs := p.MergeRequests()
+	if len(mrs) != 2 || mrs[1].SourceBranch != "changelog-v1.0.0" || mrs[1].State != "opened" {
+		t.Fatalf("got merge requests %+v, want the changelog merge request", mrs)
+	}
+	if !strings.Contains(mrs[1].Description, "v1.0.0") || !strings.Contains(mrs[1].Description, "/release-note-none") {
+		t.Errorf("got description %q, want the tag and /release-note-none", mrs[1].Description)
+	}
+
+	// the second run resets the branch onto the ref which moved on, and updates the merge request
+	p.Commit("master", "chore: more", map[string]string{"b.go": "b"})
+	s.ResetRequests()
+	if _, err := run(t, s, "-t", "v1.0.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if mrs = p.MergeRequests(); len(mrs) != 2 {
+		t.Fatalf("got %d merge requests, want the open one reused", len(mrs))
+	}
+	if b, ok := p.File("changelog-v1.0.0", "b.go"); !ok || b != "b" {
+		t.Error("got the branch not reset onto the ref")
+	}
+	if again, _ := p.File("changelog-v1.0.0", "CHANGELOG.md"); again != content {
+		t.Errorf("got changelog\n%s\nwant\n%s", again, content)
+	}
+	if got := requestsOf(s, "POST /projects/group/app/repository/branches"); len(got) != 0 {
+		t.Errorf("got %v, want the existing branch reused", got)
+	}
+	if got := requestsOf(s, "PUT /projects/group/app/merge_requests/2"); len(got) != 1 {
+		t.Errorf("got %v, want the merge request updated once", s.Requests())
+	}
+
+	// after merging, a new tag gets its own branch and merge request on top of the merged changelog
+	if _, err := s.Client().AcceptMR("group/app", 2); err != nil {
+		t.Fatal(err)
+	}
+	p.Merge(gitlab.MergeRequest{Title: "fix: a bug"}, map[string]string{"a.go": "fixed"})
+	p.Tag("v1.1.0", "master")
+	p.Release("v1.1.0", "**Bug Fix:**\n\n- a bug (!3)")
+	if _, err := run(t, s, "-t", "v1.1.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = p.File("changelog-v1.1.0", "CHANGELOG.md")
+	if !strings.Contains(content, "v1.1.0") || !strings.Contains(content, "a bug (!3)") || !strings.Contains(content, "first feature (!1)") {
+		t.Errorf("got changelog\n%s\nwant both versions", content)
+	}
+	if mrs = p.MergeRequests(); len(mrs) != 4 || mrs[3].SourceBranch != "changelog-v1.1.0" {
+		t.Errorf("got merge requests %+v, want a new one for v1.1.0", mrs)
+	}
+}
+
+func TestChangelogRequiresRef(t *testing.T) {
+	s, _ := newProject(t)
+	defer s.Close()
+	if _, err := run(t, s, "-t", "v1.0.0"); err == nil || !strings.Contains(err.Error(), `"ref"`) {
+		t.Errorf("got %v, want --ref required outside CI", err)
+	}
+}
+
+func TestCommitActions(t *testing.T) {
+	files := []*repoFile{
+		{path: "CHANGELOG.md", content: "new", exists: true, lastCommitID: "abc"},
+		{path: "VERSION", content: "1.0.0"},
+	}
+	checked := commitActions(files, true)
+	if checked[0].Action != gitlab.CommitActionUpdate || checked[0].LastCommitID != "abc" || checked[1].Action != gitlab.CommitActionCreate {
+		t.Errorf("got actions %+v", checked)
+	}
+	// forced commits replace the branch, the last commits are not checked
+	if forced := commitActions(files, false); forced[0].LastCommitID != "" {
+		t.Errorf("got last commit %q of a forced commit", forced[0].LastCommitID)
+	}
+}
+
+func TestChangelogCheck(t *testing.T) {
+	s, _ := newProject(t)
+	defer s.Close()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+	if err = ioutil.WriteFile("CHANGELOG.md", []byte(initialChangelog), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = run(t, s, "-t", "v1.0.0", "--check"); err == nil || !strings.Contains(err.Error(), "out of date: CHANGELOG.md") {
+		t.Errorf("got %v, want the changelog out of date", err)
+	}
+	if b, _ := ioutil.ReadFile("CHANGELOG.md"); string(b) != initialChangelog {
+		t.Errorf("got changelog written by --check\n%s", b)
+	}
+	if _, err = run(t, s, "-t", "v1.0.0", "--local"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = run(t, s, "-t", "v1.0.0", "--check"); err != nil {
+		t.Errorf("got %v after updating the changelog, want it up to date", err)
+	}
+}
+
+func TestRebuildResume(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Commit("master", "chore: init", map[string]string{"CHANGELOG.md": initialChangelog})
+	p.Merge(gitlab.MergeRequest{Title: "feat: first feature"}, nil)
+	p.Commit("master", "chore: prepare v1.0.0", nil)
+	p.Tag("v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "feat: second feature"}, nil)
+	p.Commit("master", "chore: prepare v1.1.0", nil)
+	p.Tag("v1.1.0", "master")
+	// merge requests are fetched one by one, and !2 fails once
+	s.Fail(http.MethodPost, "/api/graphql", http.StatusUnauthorized, -1)
+	s.Fail(http.MethodGet, "/projects/group/app/merge_requests/2", http.StatusNotFound, 1)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	out, err := run(t, s, "--rebuild", "--ref", "master", "--strict", "--state-file", stateFile)
+	if err == nil || !strings.Contains(err.Error(), "!2") {
+		t.Fatalf("got %v, want !2 missing", err)
+	}
+	if b, err := ioutil.ReadFile(stateFile); err != nil || !strings.Contains(string(b), "v1.0.0") || strings.Contains(string(b), "v1.1.0") {
+		t.Fatalf("got state %s, %v, want v1.0.0 saved", b, err)
+	}
+
+	s.ResetRequests()
+	out, err = run(t, s, "--rebuild", "--ref", "master", "--strict", "--state-file", stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "[1/2] v1.0.0 (resumed)") || !strings.Contains(out, "[2/2] v1.1.0 (computed)") {
+		t.Errorf("got progress\n%s", out)
+	}
+	if got := requestsOf(s, "GET /projects/group/app/merge_requests/1"); len(got) != 0 {
+		t.Errorf("got %v, want v1.0.0 resumed from the state file", got)
+	}
+	if _, err = os.Stat(stateFile); !os.IsNotExist(err) {
+		t.Errorf("got state file left after the rebuild: %v", err)
+	}
+	content, _ := p.File("changelog-rebuild", "CHANGELOG.md")
+	for _, title := range []string{"first feature", "second feature"} {
+		if !strings.Contains(content, title) {
+			t.Errorf("got changelog\n%s\nwant %q", content, title)
+		}
+	}
+}
+
+// headings returns the version headings of the changelog without their dates.
+func headings(content string) []string {
+	var names []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "# ") && line != strings.TrimSpace(initialChangelog) {
+			names = append(names, strings.Fields(line)[1])
+		}
+	}
+	return names
+}
+
+func TestComponentInSharedChangelog(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	cfg := &config.Config{Components: []config.Component{{Name: "api", TagPrefix: "api/", Paths: []string{"api/**"}}}}
+	rootVersion := "# v1.0.0 (2024-01-01)\n\n_New Features:_\n\n- root feature (!1)\n"
+	p.Commit("master", "chore: init", map[string]string{"CHANGELOG.md": initialChangelog + "\n" + rootVersion})
+	p.Merge(gitlab.MergeRequest{Title: "feat: api feature"}, map[string]string{"api/a.go": "a"})
+	p.Tag("api/v1.0.0", "master")
+	p.Release("api/v1.0.0", "_New Features:_\n\n- api feature (!1)")
+
+	if _, err := runWithConfig(t, s, cfg, "-t", "api/v1.0.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Client().AcceptMR("group/app", 2); err != nil {
+		t.Fatal(err)
+	}
+	p.Merge(gitlab.MergeRequest{Title: "fix: api bug"}, map[string]string{"api/a.go": "fixed"})
+	p.Tag("api/v1.1.0", "master")
+	p.Release("api/v1.1.0", "**Bug Fix:**\n\n- api bug (!3)")
+	if _, err := runWithConfig(t, s, cfg, "-t", "api/v1.1.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	updated, _ := p.File("changelog-api/v1.1.0", "CHANGELOG.md")
+	if _, err := runWithConfig(t, s, cfg, "--rebuild", "--component", "api", "--ref", "master",
+		"--state-file", filepath.Join(t.TempDir(), "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _ := p.File("changelog-rebuild-api", "CHANGELOG.md")
+
+	// both commands write the whole tag to the shared file, sorted among the versions of the same component,
+	// and the rebuild keeps the root versions
+	want := []string{"api/v1.1.0", "api/v1.0.0", "v1.0.0"}
+	for name, content := range map[string]string{"updated": updated, "rebuilt": rebuilt} {
+		if got := headings(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("got %s changelog versions %v, want %v\n%s", name, got, want, content)
+		}
+	}
+	if !strings.Contains(rebuilt, rootVersion) || rebuilt != updated {
+		t.Errorf("got rebuilt changelog\n%s\nwant the updated one\n%s", rebuilt, updated)
+	}
+}
+
+// updatedFiles returns the paths updated by the commit request, sorted.
+func updatedFiles(req gitlab.CommitRequest) []string {
+	var paths []string
+	for _, a := range req.Actions {
+		if a.Action == gitlab.CommitActionUpdate {
+			paths = append(paths, a.FilePath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestComponentChangelogsInOneCommit(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	cfg := &config.Config{Components: []config.Component{
+		{Name: "api", TagPrefix: "api/", Paths: []string{"api/**"}, Changelog: "api/CHANGELOG.md"},
+		{Name: "web", TagPrefix: "web/", Paths: []string{"web/**"}, Changelog: "web/CHANGELOG.md"},
+	}}
+	p.Commit("master", "chore: init", map[string]string{"api/CHANGELOG.md": initialChangelog, "web/CHANGELOG.md": initialChangelog})
+	p.Merge(gitlab.MergeRequest{Title: "feat: api feature"}, map[string]string{"api/a.go": "a"})
+	p.Merge(gitlab.MergeRequest{Title: "feat: web feature"}, map[string]string{"web/a.js": "a"})
+	p.Tag("api/v1.0.0", "master")
+	p.Tag("web/v2.0.0", "master")
+	p.Release("api/v1.0.0", "_New Features:_\n\n- api feature (!1)")
+	p.Release("web/v2.0.0", "_New Features:_\n\n- web feature (!2)")
+
+	if _, err := runWithConfig(t, s, cfg, "-t", "api/v1.0.0", "-t", "web/v2.0.0", "--ref", "master"); err != nil {
+		t.Fatal(err)
+	}
+	requests := p.CommitRequests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d commits, want the changelogs of both components in one", len(requests))
+	}
+	if got, want := updatedFiles(requests[0]), []string{"api/CHANGELOG.md", "web/CHANGELOG.md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got updated files %v, want %v", got, want)
+	}
+	branch := requests[0].Branch
+	for path, want := range map[string]string{"api/CHANGELOG.md": "# v1.0.0 (", "web/CHANGELOG.md": "# v2.0.0 ("} {
+		if content, _ := p.File(branch, path); !strings.Contains(content, want) {
+			t.Errorf("got %s\n%s\nwant %q", path, content, want)
+		}
+	}
+	if mrs := p.MergeRequests(); len(mrs) != 3 || mrs[2].SourceBranch != branch {
+		t.Errorf("got merge requests %+v, want one for both tags", mrs)
+	}
+}
+
+func TestBumpVersion(t *testing.T) {
+	s, p := newProject(t)
+	defer s.Close()
+	p.Commit("master", "chore: add package.json", map[string]string{"package.json": "{\n  \"name\": \"app\",\n  \"version\": \"0.9.0\"\n}\n"})
+	cfg := &config.Config{VersionFiles: []config.VersionFile{{Path: "package.json"}}}
+
+	if _, err := runWithConfig(t, s, cfg, "-t", "v1.0.0", "--ref", "master", "--bump-version"); err != nil {
+		t.Fatal(err)
+	}
+	requests := p.CommitRequests()
+	if len(requests) != 1 {
+		t.Fatalf("got %d commits, want the version and the changelog in one", len(requests))
+	}
+	if got, want := updatedFiles(requests[0]), []string{"CHANGELOG.md", "package.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got updated files %v, want %v", got, want)
+	}
+	if !strings.HasPrefix(requests[0].CommitMessage, "chore(release): bump version") {
+		t.Errorf("got commit message %q", requests[0].CommitMessage)
+	}
+	if content, _ := p.File("changelog-v1.0.0", "package.json"); !strings.Contains(content, `"version": "1.0.0"`) {
+		t.Errorf("got package.json\n%s\nwant the version bumped", content)
+	}
+}
@@ -0,0 +1,202 @@
+package changelog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"walle/pkg/changelog"
+	"walle/pkg/config"
+	"walle/pkg/gitlab"
+	"walle/pkg/releasenote"
+	"walle/pkg/semver"
+)
+
+const defaultStateFile = ".walle-rebuild.json"
+
+// rebuildState is the release notes computed by an unfinished rebuild.
+type rebuildState struct {
+	Project   string            `json:"project"`
+	Component string            `json:"component"`
+	Notes     map[string]string `json:"notes"`
+}
+
+func (o *options) loadState() *rebuildState {
+	state := &rebuildState{Project: o.project, Component: o.component, Notes: map[string]string{}}
+	b, err := ioutil.ReadFile(o.stateFile)
+	if err != nil {
+		return state
+	}
+	saved := &rebuildState{}
+	if err = json.Unmarshal(b, saved); err != nil || saved.Project != o.project || saved.Component != o.component {
+		return state
+	}
+	if saved.Notes != nil {
+		state.Notes = saved.Notes
+	}
+	return state
+}
+
+func (o *options) saveState(state *rebuildState) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(o.stateFile, b, 0644)
+}
+
+// rebuildTags returns the tags of the component from the oldest to the newest.
+// Tags of other components and tags which are not versions are skipped.
+func (o *options) rebuildTags(scope releasenote.Scope) ([]gitlab.Tag, error) {
+	all, err := o.client.ListTags(o.project)
+	if err != nil {
+		return nil, gitlab.DescribeError(err, "list tags", gitlab.PermissionRead)
+	}
+	var tags []gitlab.Tag
+	for _, tag := range all {
+		com := o.cfg.ComponentByTag(tag.Name)
+		if o.component == "" && com != nil || o.component != "" && (com == nil || com.Name != o.component) {
+			continue
+		}
+		if _, ok := semver.Parse(tag.Name[len(scope.TagPrefix):]); !ok {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		ti, tj := tags[i].Commit.CreatedAt, tags[j].Commit.CreatedAt
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return semver.Less(tags[i].Name[len(scope.TagPrefix):], tags[j].Name[len(scope.TagPrefix):])
+	})
+	return tags, nil
+}
+
+// dropRebuiltVersions removes the versions to be rebuilt from the changelog, the preamble is kept.
+// The own changelog file of a component is cleared, in the shared file only the versions of the rebuilt tags
+// are removed, versions of the other components and their links are kept.
+func (o *options) dropRebuiltVersions(content string, com *config.Component) string {
+	doc := changelog.Parse(content)
+	if com != nil && com.Changelog != "" {
+		doc.Versions, doc.Links, doc.Trailing = nil, nil, nil
+		return doc.String()
+	}
+	var kept []*changelog.Version
+	for _, v := range doc.Versions {
+		if owner := o.cfg.ComponentByTag(v.Name); owner != com {
+			kept = append(kept, v)
+		}
+	}
+	doc.Versions = kept
+	var links []*changelog.Link
+	for _, l := range doc.Links {
+		if doc.Find(l.Label) >= 0 {
+			links = append(links, l)
+		}
+	}
+	doc.Links = links
+	if len(links) == 0 {
+		doc.Trailing = nil
+	}
+	return doc.String()
+}
+
+// runRebuild regenerates the changelog from all tags, the preamble of the existing file is kept.
+// Computed release notes are saved to the state file, so a failed rebuild resumes from where it stopped.
+func (o *options) runRebuild(cmd *cobra.Command) error {
+	var com *config.Component
+	var scope releasenote.Scope
+	if o.component != "" {
+		var err error
+		if com, err = o.cfg.GetComponent(o.component); err != nil {
+			return err
+		}
+		scope = releasenote.Scope{TagPrefix: com.TagPrefix, Paths: com.Paths}
+	}
+	path, genOpts := o.changelogOf(com)
+
+	tags, err := o.rebuildTags(scope)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return fmt.Errorf("no tags to rebuild the changelog")
+	}
+
+	releases, err := o.client.ListReleases(o.project)
+	if err != nil {
+		return gitlab.DescribeError(err, "list releases", gitlab.PermissionRead)
+	}
+	descriptions := map[string]string{}
+	for _, release := range releases {
+		descriptions[release.TagName] = release.Description
+	}
+
+	state := o.loadState()
+	out := cmd.ErrOrStderr()
+	for i := range tags {
+		tag := &tags[i]
+		status := "resumed"
+		if _, ok := state.Notes[tag.Name]; !ok {
+			if description, ok := descriptions[tag.Name]; ok && !o.recompute {
+				state.Notes[tag.Name] = description
+				status = "release"
+			} else {
+				var previous *gitlab.Tag
+				if i > 0 {
+					previous = &tags[i-1]
+				}
+				notes, err := releasenote.GetReleaseNotesBetween(o.client, o.project, previous, tag,
+					releasenote.Options{Scope: scope, Strict: o.strict})
+				if err != nil {
+					if missing := (*releasenote.MissingMergeRequestsError)(nil); errors.As(err, &missing) {
+						return fmt.Errorf("%v of %s, run again without --strict to leave them out", err, tag.Name)
+					}
+					err = gitlab.DescribeError(err, "compute release notes of "+tag.Name, gitlab.PermissionRead)
+					return fmt.Errorf("%v, run again to resume", err)
+				}
+				state.Notes[tag.Name] = notes.Notes
+				status = "computed"
+				if len(notes.Missing) > 0 {
+					status = fmt.Sprintf("computed, merge requests %s could not be fetched and are left out",
+						releasenote.FormatIIDs(notes.Missing))
+				}
+				if err = o.saveState(state); err != nil {
+					return err
+				}
+			}
+		}
+		_, _ = fmt.Fprintf(out, "[%d/%d] %s (%s)\n", i+1, len(tags), tag.Name, status)
+	}
+
+	file, err := o.loadFile(path)
+	if err != nil {
+		return err
+	}
+	file.content = o.dropRebuiltVersions(file.origin, com)
+	for _, tag := range tags {
+		file.content, err = changelog.GenerateChangelog(tag.Name, state.Notes[tag.Name], file.content, tag.Commit.CreatedAt, genOpts)
+		if err != nil {
+			return err
+		}
+	}
+
+	branchName, msg := RebuildBranchName(o.component), "docs(changelog): rebuild changelog"
+	if o.component != "" {
+		msg = fmt.Sprintf("docs(changelog): rebuild changelog of %s", o.component)
+	}
+	summary := fmt.Sprintf("Rebuild the changelog from %d tags, %s to %s.", len(tags), tags[0].Name, tags[len(tags)-1].Name)
+	if err = o.submit(branchName, msg, summary); err != nil {
+		return err
+	}
+	if err = os.Remove(o.stateFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
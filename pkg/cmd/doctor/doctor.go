@@ -0,0 +1,283 @@
+package doctor
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"walle/pkg/cmd/changelog"
+	"walle/pkg/config"
+	"walle/pkg/context"
+	"walle/pkg/gitlab"
+	"walle/pkg/utils"
+)
+
+// requiredScopes are the scopes walle needs, it only calls the REST and GraphQL API. `read_repository` and
+// `write_repository` grant Git over HTTP, they do not authorize API calls.
+var requiredScopes = []string{"api"}
+
+// missingScopes returns the required scopes the token does not have.
+func missingScopes(granted []string) []string {
+	var missing []string
+	for _, scope := range requiredScopes {
+		if !utils.InStringArray(scope, granted) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+// checkTimeout is the time limit of each request of doctor.
+const checkTimeout = 10 * time.Second
+
+// checkConfig makes requests fail fast, a wrong or unreachable host is reported without retrying for minutes.
+type checkConfig struct {
+	*config.Config
+}
+
+func (c *checkConfig) GetMaxRetries() int {
+	return 0
+}
+
+func (c *checkConfig) GetTimeout() time.Duration {
+	return checkTimeout
+}
+
+func NewCmdDoctor(ctx *context.Context) *cobra.Command {
+	opts := &options{
+		cfg: ctx.Config,
+	}
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "check the token, its scopes and the access to the project",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.client = gitlab.NewClient(ctx.Logger, &checkConfig{ctx.Config})
+			opts.project = ctx.Project
+			opts.out = cmd.OutOrStdout()
+			return opts.Run()
+		},
+	}
+
+	cmd.Flags().StringVarP(&opts.tag, "tag", "t", "", "check whether the tag, or tags matching the pattern like `v*`, can be created")
+	cmd.Flags().StringVarP(&opts.branch, "branch", "b", "", "the target branch of changelog MRs. default is the default branch")
+	return cmd
+}
+
+type options struct {
+	client gitlab.Client
+	cfg    *config.Config
+	out    io.Writer
+
+	project string
+	tag     string
+	branch  string
+
+	// user is the user of the token, nil if it is not checked
+	user     *gitlab.User
+	failures int
+}
+
+func (o *options) ok(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(o.out, "[ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (o *options) warn(format string, args ...interface{}) {
+	_, _ = fmt.Fprintf(o.out, "[warn] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (o *options) fail(format string, args ...interface{}) {
+	o.failures++
+	_, _ = fmt.Fprintf(o.out, "[fail] %s\n", fmt.Sprintf(format, args...))
+}
+
+// Run checks everything walle needs and prints a report, an error is returned if any check fails.
+func (o *options) Run() error {
+	if o.check() {
+		o.checkProject()
+	}
+	if o.failures > 0 {
+		return fmt.Errorf("%d check(s) failed", o.failures)
+	}
+	return nil
+}
+
+// check checks the connection and the token, false is returned if other checks cannot continue.
+func (o *options) check() bool {
+	apiBase := o.cfg.GetAPIBase()
+	if o.cfg.GetToken() == "" {
+		o.fail("no token, set --token, --token-file, --token-command or WALLE_GITLAB_TOKEN")
+		return false
+	}
+
+	version, err := o.client.GetVersion()
+	switch {
+	case err == nil:
+		o.ok("connected to %s (GitLab %s)", apiBase, version.Version)
+	case gitlab.StatusCode(err) == 0:
+		o.fail("cannot connect to %s, check --host or WALLE_GITLAB_HOST: %v", apiBase, err)
+		return false
+	default:
+		o.ok("connected to %s", apiBase)
+	}
+
+	if o.cfg.AuthType == gitlab.AuthJobToken {
+		o.warn("job tokens cannot be verified, they can only access the project of the job and few endpoints")
+		return true
+	}
+
+	user, err := o.client.CurrentUser()
+	if err != nil {
+		if gitlab.IsUnauthorized(err) {
+			o.fail("the token is invalid, expired or revoked: %v", err)
+		} else {
+			o.fail("failed to get the user of the token: %v", err)
+		}
+		return false
+	}
+	o.ok("authenticated as @%s (%s)", user.Username, user.Name)
+	o.user = &user
+
+	if o.cfg.AuthType == gitlab.AuthOAuth {
+		o.warn("scopes of OAuth tokens cannot be verified")
+		return true
+	}
+	token, err := o.client.GetCurrentToken()
+	if err != nil {
+		o.warn("cannot verify the scopes of the token, it may not be an access token or GitLab is older than 15.5: %v", err)
+		return true
+	}
+	if token.ExpiresAt != "" {
+		o.ok("token %q expires at %s", token.Name, token.ExpiresAt)
+	}
+	if missing := missingScopes(token.Scopes); len(missing) > 0 {
+		o.fail("token scopes are %s, missing %s", strings.Join(token.Scopes, ", "), strings.Join(missing, ", "))
+	} else {
+		o.ok("token scopes: %s", strings.Join(token.Scopes, ", "))
+	}
+	return true
+}
+
+func (o *options) checkProject() {
+	if o.project == "" {
+		o.warn("no project, set --project or WALLE_PROJECT to check the project access")
+		return
+	}
+	project, err := o.client.GetProject(o.project)
+	if err != nil {
+		if gitlab.IsNotFound(err) {
+			o.fail("project %s does not exist or the token has no access to it", o.project)
+		} else {
+			o.fail("failed to get project %s: %v", o.project, err)
+		}
+		return
+	}
+	o.ok("project %s found", project.PathWithNamespace)
+
+	level := project.Permissions.AccessLevel()
+	// administrators have access to every project without being members
+	if o.user != nil && o.user.IsAdmin {
+		level = gitlab.AdminAccess
+	}
+	if level < gitlab.DeveloperAccess {
+		o.fail("role is %s, creating tags and branches needs at least Developer", gitlab.AccessLevelName(level))
+	} else {
+		o.ok("role is %s", gitlab.AccessLevelName(level))
+	}
+
+	o.checkProtectedTags(level)
+	o.checkProtectedBranches(level, project.DefaultBranch)
+}
+
+// checkProtectedTags checks the protected tags matching --tag, nothing is checked without it.
+func (o *options) checkProtectedTags(level int) {
+	if o.tag == "" {
+		return
+	}
+	tags, err := o.client.ListProtectedTags(o.project)
+	if err != nil {
+		o.warn("cannot list protected tags: %v", err)
+		return
+	}
+	for _, t := range tags {
+		if !matchWildcard(t.Name, o.tag) && !matchWildcard(o.tag, t.Name) {
+			continue
+		}
+		if allowed(t.CreateAccessLevels, level) {
+			o.ok("protected tag %s can be created by %s", t.Name, describe(t.CreateAccessLevels))
+		} else {
+			o.fail("protected tag %s can only be created by %s, `walle release` cannot create matched tags", t.Name, describe(t.CreateAccessLevels))
+		}
+	}
+}
+
+func (o *options) checkProtectedBranches(level int, defaultBranch string) {
+	branches, err := o.client.ListProtectedBranches(o.project)
+	if err != nil {
+		o.warn("cannot list protected branches: %v", err)
+		return
+	}
+	target := o.branch
+	if target == "" {
+		target = defaultBranch
+	}
+	// without --tag, the branch of `walle changelog --rebuild` is checked
+	changelogBranch := changelog.RebuildBranchName("")
+	if o.tag != "" {
+		changelogBranch = changelog.BranchName([]string{o.tag})
+	}
+	for _, b := range branches {
+		// the branch is a pattern too if --tag is, e.g. `changelog-v*`
+		matched := matchWildcard(b.Name, changelogBranch) || matchWildcard(changelogBranch, b.Name)
+		if matched && !allowed(b.PushAccessLevels, level) {
+			o.fail("protected branch %s blocks pushing changelog branches, allowed to push: %s", b.Name, describe(b.PushAccessLevels))
+		}
+		if matchWildcard(b.Name, target) {
+			if allowed(b.MergeAccessLevels, level) {
+				o.ok("changelog MRs can be merged into %s", target)
+			} else {
+				o.warn("changelog MRs into %s can only be merged by %s, `walle changelog --merge` will fail", target, describe(b.MergeAccessLevels))
+			}
+		}
+	}
+}
+
+// allowed reports whether the role matches any role rule, rules of users and groups are not checked.
+func allowed(rules []gitlab.AccessLevelRule, level int) bool {
+	for _, r := range rules {
+		if r.UserID != 0 || r.GroupID != 0 {
+			continue
+		}
+		if r.AccessLevel != gitlab.NoAccess && level >= r.AccessLevel {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(rules []gitlab.AccessLevelRule) string {
+	var ds []string
+	for _, r := range rules {
+		d := r.AccessLevelDescription
+		if d == "" {
+			d = gitlab.AccessLevelName(r.AccessLevel)
+		}
+		ds = append(ds, d)
+	}
+	if len(ds) == 0 {
+		return "no one"
+	}
+	return strings.Join(ds, ", ")
+}
+
+// matchWildcard matches names of protected tags and branches, `*` matches any characters.
+func matchWildcard(pattern, name string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(name)
+}
@@ -0,0 +1,119 @@
+package doctor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/config"
+	"walle/pkg/context"
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestMissingScopes(t *testing.T) {
+	testcases := []struct {
+		granted []string
+		want    []string
+	}{
+		{granted: []string{"api"}},
+		{granted: []string{"api", "read_api", "read_repository", "write_repository"}},
+		{granted: []string{"read_api", "read_repository", "write_repository"}, want: []string{"api"}},
+		{granted: []string{"read_user"}, want: []string{"api"}},
+		{want: []string{"api"}},
+	}
+	for _, tc := range testcases {
+		if got := missingScopes(tc.granted); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("missingScopes(%v) = %v, want %v", tc.granted, got, tc.want)
+		}
+	}
+}
+
+func runDoctor(t *testing.T, cfg *config.Config, args ...string) (string, error) {
+	ctx := context.NewContext(nil, cfg, logrus.NewEntry(logrus.New()))
+	ctx.Project = "group/app"
+	cmd := NewCmdDoctor(&ctx)
+	var out bytes.Buffer
+	cmd.SetOut(&out)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+func TestDoctor(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	s.Scopes = []string{"api"}
+	s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+
+	out, err := runDoctor(t, &config.Config{Host: s.URL, Token: "secret"})
+	if err != nil || !strings.Contains(out, "[ok]   token scopes: api") {
+		t.Errorf("got %v and\n%s\nwant an api token to pass", err, out)
+	}
+}
+
+func TestDoctorUnreachableHost(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	host := server.URL
+	server.Close()
+
+	start := time.Now()
+	out, err := runDoctor(t, &config.Config{Host: host, Token: "secret"})
+	if err == nil || !strings.Contains(out, "[fail] cannot connect to "+host) {
+		t.Errorf("got %v and\n%s\nwant the connection to fail", err, out)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("got the failure after %s, want no retries", elapsed)
+	}
+}
+
+func TestDoctorProtectedTags(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	s.Scopes = []string{"api"}
+	// an administrator who is not a member of the project
+	s.User.IsAdmin = true
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app",
+		Permissions: gitlab.ProjectPermissions{ProjectAccess: &gitlab.Access{AccessLevel: gitlab.NoAccess}}})
+	p.ProtectTag("release-*", gitlab.NoAccess)
+	cfg := &config.Config{Host: s.URL, Token: "secret"}
+
+	for _, args := range [][]string{nil, {"-t", "v1.0.0"}} {
+		out, err := runDoctor(t, cfg, args...)
+		if err != nil || !strings.Contains(out, "[ok]   role is Admin") {
+			t.Errorf("%v: got %v and\n%s\nwant the administrator to pass", args, err, out)
+		}
+	}
+	out, err := runDoctor(t, cfg, "-t", "release-1")
+	if err == nil || !strings.Contains(out, "[fail] protected tag release-*") {
+		t.Errorf("got %v and\n%s\nwant the protected tag to fail", err, out)
+	}
+}
+
+func TestDoctorProtectedChangelogBranches(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	s.Scopes = []string{"api"}
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.ProtectBranch("changelog-v1.*", gitlab.NoAccess, gitlab.MaintainerAccess)
+	cfg := &config.Config{Host: s.URL, Token: "secret"}
+
+	for _, tag := range []string{"v1.2.0", "v*"} {
+		out, err := runDoctor(t, cfg, "-t", tag)
+		if err == nil || !strings.Contains(out, "[fail] protected branch changelog-v1.* blocks pushing changelog branches") {
+			t.Errorf("-t %s: got %v and\n%s\nwant the protected branch to fail", tag, err, out)
+		}
+	}
+	if out, err := runDoctor(t, cfg, "-t", "v2.0.0"); err != nil {
+		t.Errorf("-t v2.0.0: got %v and\n%s\nwant the unrelated branch to pass", err, out)
+	}
+}
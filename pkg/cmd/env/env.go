@@ -0,0 +1,57 @@
+package env
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"walle/pkg/context"
+)
+
+func NewCmdEnv(ctx *context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "print the settings and where they are read from, only GitLab CI variables are detected",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			ciName := "none"
+			if ctx.CI != nil {
+				ciName = ctx.CI.Provider
+			}
+			_, _ = fmt.Fprintf(w, "ci\t%s\n", ciName)
+
+			var ref, tag string
+			if ctx.CI != nil {
+				ref, tag = ctx.CI.Ref, ctx.CI.Tag
+			}
+			token := ""
+			if ctx.Config.Token != "" {
+				token = "********"
+			}
+			settings := []struct {
+				name, value string
+			}{
+				{"host", ctx.Config.Host},
+				{"project", ctx.Project},
+				{"token", token},
+				{"auth-type", ctx.Config.AuthType},
+				{"ref", ref},
+				{"tag", tag},
+				{"ca-cert", ctx.Config.CACert},
+				{"client-cert", ctx.Config.ClientCert},
+				{"proxy", ctx.Config.Proxy},
+				{"cache-dir", ctx.Config.GetCacheDir()},
+			}
+			for _, s := range settings {
+				value, source := s.value, ctx.Sources[s.name]
+				if value == "" {
+					value, source = "-", "not set"
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t(%s)\n", s.name, value, source)
+			}
+			return w.Flush()
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,66 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/ci"
+	"walle/pkg/config"
+	"walle/pkg/context"
+)
+
+func TestEnv(t *testing.T) {
+	testcases := []struct {
+		ci    *ci.Env
+		want  []string
+		unset []string
+	}{
+		{
+			want:  []string{"ci none", "host https://gitlab.example.com (flag --host)", "token ******** (env WALLE_GITLAB_TOKEN)"},
+			unset: []string{"ref", "tag", "cache-dir"},
+		},
+		{
+			ci: &ci.Env{Provider: ci.ProviderGitLab, Ref: "abc", Tag: "v1.0.0"},
+			want: []string{"ci gitlab", "ref abc (GitLab CI CI_COMMIT_SHA)", "tag v1.0.0 (GitLab CI CI_COMMIT_TAG)",
+				"token ******** (env WALLE_GITLAB_TOKEN)"},
+			unset: []string{"cache-dir"},
+		},
+	}
+	for i, tc := range testcases {
+		cfg := &config.Config{Host: "https://gitlab.example.com", Token: "secret"}
+		ctx := context.NewContext(nil, cfg, logrus.NewEntry(logrus.New()))
+		ctx.CI = tc.ci
+		ctx.Sources = map[string]string{"host": "flag --host", "token": "env WALLE_GITLAB_TOKEN"}
+		if tc.ci != nil {
+			ctx.Sources["ref"] = "GitLab CI CI_COMMIT_SHA"
+			ctx.Sources["tag"] = "GitLab CI CI_COMMIT_TAG"
+		}
+		cmd := NewCmdEnv(&ctx)
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs(nil)
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		lines := map[string]bool{}
+		for _, line := range strings.Split(out.String(), "\n") {
+			lines[strings.Join(strings.Fields(line), " ")] = true
+		}
+		for _, want := range tc.want {
+			if !lines[want] {
+				t.Errorf("case %d: got\n%s\nwant the line %q", i, out.String(), want)
+			}
+		}
+		for _, name := range tc.unset {
+			if want := name + " - (not set)"; !lines[want] {
+				t.Errorf("case %d: got\n%s\nwant the line %q", i, out.String(), want)
+			}
+		}
+		if strings.Contains(out.String(), "secret") {
+			t.Errorf("case %d: got the token printed\n%s", i, out.String())
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"walle/pkg/gitlab"
+)
+
+// parseAsset parses a link of `--asset`, `name=url` or `type:name=url`, e.g. `package:walle-linux-amd64=https://...`.
+func parseAsset(spec string) (gitlab.ReleaseLink, error) {
+	i := strings.Index(spec, "=")
+	if i < 0 {
+		return gitlab.ReleaseLink{}, fmt.Errorf("invalid asset %q, want name=url or type:name=url", spec)
+	}
+	link := gitlab.ReleaseLink{Name: spec[:i], URL: spec[i+1:]}
+	if j := strings.Index(link.Name, ":"); j >= 0 && gitlab.ValidateLinkType(link.Name[:j]) == nil {
+		link.LinkType, link.Name = link.Name[:j], link.Name[j+1:]
+	}
+	return link, validateLink(link)
+}
+
+// readAssetFile reads the links of `--asset-file`, a JSON array like `[{"name": "...", "url": "...", "link_type": "package"}]`.
+func readAssetFile(path string) ([]gitlab.ReleaseLink, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var links []gitlab.ReleaseLink
+	if err = json.Unmarshal(b, &links); err != nil {
+		return nil, fmt.Errorf("failed to parse asset file %s: %v", path, err)
+	}
+	for _, link := range links {
+		if err = validateLink(link); err != nil {
+			return nil, fmt.Errorf("asset file %s: %v", path, err)
+		}
+	}
+	return links, nil
+}
+
+func validateLink(link gitlab.ReleaseLink) error {
+	if link.Name == "" {
+		return fmt.Errorf("asset %s has no name", link.URL)
+	}
+	if u, err := url.Parse(link.URL); err != nil || !u.IsAbs() {
+		return fmt.Errorf("asset %s has an invalid url %q", link.Name, link.URL)
+	}
+	return gitlab.ValidateLinkType(link.LinkType)
+}
+
+// assets returns the links of the flags, names must be unique in a release.
+func (o *releaseOptions) assets() ([]gitlab.ReleaseLink, error) {
+	var links []gitlab.ReleaseLink
+	if o.assetFile != "" {
+		fromFile, err := readAssetFile(o.assetFile)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, fromFile...)
+	}
+	for _, spec := range o.assetSpecs {
+		link, err := parseAsset(spec)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return mergeLinks(nil, links)
+}
+
+// mergeLinks returns all links, names must be unique in a release.
+func mergeLinks(a, b []gitlab.ReleaseLink) ([]gitlab.ReleaseLink, error) {
+	links := append(append([]gitlab.ReleaseLink(nil), a...), b...)
+	names := map[string]bool{}
+	for _, link := range links {
+		if names[link.Name] {
+			return nil, fmt.Errorf("duplicate asset %s", link.Name)
+		}
+		names[link.Name] = true
+	}
+	return links, nil
+}
+
+// updateLinks creates the links missing from the release, and updates the links of the same names.
+func (o *releaseOptions) updateLinks(release *gitlab.Release, links []gitlab.ReleaseLink) error {
+	existing := map[string]gitlab.ReleaseLink{}
+	for _, link := range release.Assets.Links {
+		existing[link.Name] = link
+	}
+	for _, link := range links {
+		old, ok := existing[link.Name]
+		var err error
+		switch {
+		case !ok:
+			_, err = o.client.CreateReleaseLink(o.project, o.tag, link)
+		case old.URL != link.URL || link.LinkType != "" && old.LinkType != link.LinkType:
+			link.ID = old.ID
+			_, err = o.client.UpdateReleaseLink(o.project, o.tag, link)
+		}
+		if err != nil {
+			return gitlab.DescribeError(err, "link asset "+link.Name, gitlab.PermissionRelease)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package release
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestParseAsset(t *testing.T) {
+	testcases := []struct {
+		spec    string
+		want    gitlab.ReleaseLink
+		wantErr bool
+	}{
+		{spec: "walle=https://example.com/walle", want: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle"}},
+		{spec: "package:walle=https://example.com/walle",
+			want: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle", LinkType: gitlab.LinkTypePackage}},
+		// the prefix is a type only if it is a link type
+		{spec: "docs:guide=https://example.com/guide", want: gitlab.ReleaseLink{Name: "docs:guide", URL: "https://example.com/guide"}},
+		// the name ends at the first `=`, the url may contain more
+		{spec: "walle=https://example.com/download?file=walle",
+			want: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/download?file=walle"}},
+		{spec: "https://example.com/walle", wantErr: true},
+		{spec: "=https://example.com/walle", wantErr: true},
+		{spec: "image:=https://example.com/walle", wantErr: true},
+		{spec: "walle=walle-linux-amd64", wantErr: true},
+	}
+	for _, tc := range testcases {
+		got, err := parseAsset(tc.spec)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseAsset(%q) got error %v, want error %v", tc.spec, err, tc.wantErr)
+			continue
+		}
+		if !tc.wantErr && got != tc.want {
+			t.Errorf("parseAsset(%q) = %+v, want %+v", tc.spec, got, tc.want)
+		}
+	}
+}
+
+func TestReadAssetFile(t *testing.T) {
+	testcases := []struct {
+		name    string
+		content string
+		want    []gitlab.ReleaseLink
+		wantErr bool
+	}{
+		{name: "links", content: `[{"name": "walle", "url": "https://example.com/walle", "link_type": "package"}, {"name": "docs", "url": "https://example.com/docs"}]`,
+			want: []gitlab.ReleaseLink{
+				{Name: "walle", URL: "https://example.com/walle", LinkType: gitlab.LinkTypePackage},
+				{Name: "docs", URL: "https://example.com/docs"},
+			}},
+		{name: "empty", content: `[]`, want: []gitlab.ReleaseLink{}},
+		{name: "not an array", content: `{"name": "walle"}`, wantErr: true},
+		{name: "no url", content: `[{"name": "walle"}]`, wantErr: true},
+		{name: "invalid type", content: `[{"name": "walle", "url": "https://example.com/walle", "link_type": "binary"}]`, wantErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "assets.json")
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readAssetFile(path)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+	if _, err := readAssetFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("got no error for a missing file")
+	}
+}
+
+func TestMergeLinks(t *testing.T) {
+	walle := gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle"}
+	docs := gitlab.ReleaseLink{Name: "docs", URL: "https://example.com/docs"}
+	testcases := []struct {
+		name    string
+		a, b    []gitlab.ReleaseLink
+		want    []gitlab.ReleaseLink
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "unique", a: []gitlab.ReleaseLink{walle}, b: []gitlab.ReleaseLink{docs}, want: []gitlab.ReleaseLink{walle, docs}},
+		{name: "duplicate across", a: []gitlab.ReleaseLink{walle}, b: []gitlab.ReleaseLink{docs, walle}, wantErr: true},
+		{name: "duplicate within", b: []gitlab.ReleaseLink{docs, {Name: "docs", URL: "https://example.com/other"}}, wantErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := mergeLinks(tc.a, tc.b)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateLinks(t *testing.T) {
+	testcases := []struct {
+		name string
+		link gitlab.ReleaseLink
+		// request is the request sending the link, empty if the link is unchanged.
+		request string
+	}{
+		{name: "unchanged", link: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle"}},
+		{name: "same type", link: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle", LinkType: gitlab.LinkTypeOther}},
+		{name: "new url", link: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/v2/walle"}, request: "PUT"},
+		{name: "new type", link: gitlab.ReleaseLink{Name: "walle", URL: "https://example.com/walle", LinkType: gitlab.LinkTypePackage}, request: "PUT"},
+		{name: "new name", link: gitlab.ReleaseLink{Name: "docs", URL: "https://example.com/docs"}, request: "POST"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := gitlabtest.NewServer()
+			defer s.Close()
+			p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+			client := s.Client()
+			_, err := client.CreateRelease("group/app", gitlab.ReleaseRequest{
+				TagName: "v1.0.0",
+				Ref:     "master",
+				Assets: &gitlab.ReleaseAssets{Links: []gitlab.ReleaseLink{
+					{Name: "walle", URL: "https://example.com/walle", LinkType: gitlab.LinkTypeOther},
+				}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			release, err := client.GetRelease("group/app", "v1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.ResetRequests()
+
+			o := &releaseOptions{client: client, project: "group/app", tag: "v1.0.0"}
+			if err = o.updateLinks(release, []gitlab.ReleaseLink{tc.link}); err != nil {
+				t.Fatal(err)
+			}
+			var requests []string
+			for _, r := range s.Requests() {
+				requests = append(requests, strings.Fields(r)[0])
+			}
+			if tc.request == "" && len(requests) > 0 || tc.request != "" && !reflect.DeepEqual(requests, []string{tc.request}) {
+				t.Errorf("got requests %v, want %q", s.Requests(), tc.request)
+			}
+
+			var names []string
+			for _, link := range p.Releases()["v1.0.0"].Assets.Links {
+				names = append(names, link.Name)
+				if link.Name == tc.link.Name && link.URL != tc.link.URL {
+					t.Errorf("got url %s of %s, want %s", link.URL, link.Name, tc.link.URL)
+				}
+			}
+			sort.Strings(names)
+			if tc.link.Name == "docs" && !reflect.DeepEqual(names, []string{"docs", "walle"}) {
+				t.Errorf("got links %v, want the existing link kept", names)
+			}
+		})
+	}
+}
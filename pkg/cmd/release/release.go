@@ -2,6 +2,9 @@ package release
 
 import (
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -23,6 +26,27 @@ func NewReleaseCmd(ctx *context.Context) *cobra.Command {
 		Short: "release a new version ",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.project = ctx.Project
+			if ctx.CI != nil {
+				if opts.tag == "" {
+					opts.tag = ctx.CI.Tag
+				}
+				if opts.ref == "" {
+					opts.ref = ctx.CI.Ref
+				}
+			}
+			if opts.tag == "" {
+				return fmt.Errorf(`required flag(s) "tag" not set`)
+			}
+			if opts.ref == "" {
+				return fmt.Errorf(`required flag(s) "ref" not set`)
+			}
+			if len(args) > 0 {
+				// files of `--upload dist/*` expanded by the shell, they are paths instead of patterns
+				if len(opts.uploads) == 0 {
+					return fmt.Errorf("unexpected arguments %v", args)
+				}
+				opts.uploadArgs = args
+			}
 			if err := opts.Run(cmd, args); err != nil {
 				return err
 			}
@@ -30,12 +54,23 @@ func NewReleaseCmd(ctx *context.Context) *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&opts.tag, "tag", "t", "", "The name of a tag (required)")
-	cmd.Flags().StringVarP(&opts.ref, "ref", "", "", "Create tag using commit SHA, another tag name, or branch name (required)")
+	cmd.Flags().StringVarP(&opts.tag, "tag", "t", "", "The name of a tag (required). default is CI_COMMIT_TAG in GitLab CI")
+	cmd.Flags().StringVarP(&opts.ref, "ref", "", "", "Create tag using commit SHA, another tag name, or branch name (required). default is CI_COMMIT_SHA in GitLab CI")
 	cmd.Flags().StringVarP(&opts.msg, "message", "m", "", "The annotation of tag")
 	cmd.Flags().BoolVar(&opts.dry, "dry", false, "Print changelog only")
-	_ = cmd.MarkFlagRequired("tag")
-	_ = cmd.MarkFlagRequired("ref")
+	cmd.Flags().StringVarP(&opts.component, "component", "c", "", "The component of a monorepo defined in config file. Detected by tag prefix by default")
+	cmd.Flags().StringVar(&opts.name, "name", "", "The name of the release. default is the tag name")
+	cmd.Flags().StringSliceVar(&opts.milestones, "milestone", nil, "The title of a milestone associated with the release, can be repeated")
+	cmd.Flags().StringVar(&opts.releasedAt, "released-at", "", "The date of the release in RFC 3339, e.g. 2020-01-01T00:00:00Z. default is now")
+	cmd.Flags().StringArrayVar(&opts.assetSpecs, "asset", nil, "A link of the release as `name=url` or `type:name=url`, "+
+		"type is other, runbook, package or image. can be repeated")
+	cmd.Flags().StringVar(&opts.assetFile, "asset-file", "", `A JSON file of release links, e.g. [{"name": "...", "url": "...", "link_type": "package"}]`)
+	cmd.Flags().StringArrayVar(&opts.uploads, "upload", nil, "Files to upload to the generic package registry and link from the release, "+
+		"glob patterns like 'dist/*'. can be repeated")
+	cmd.Flags().StringVar(&opts.pkgName, "package-name", "", "The name of the generic package of uploaded files. default is the component or project name")
+	cmd.Flags().StringVar(&opts.checksumsFile, "checksums-file", "checksums.txt", "The file to write SHA-256 checksums of uploaded files to, it is uploaded as well. empty to disable")
+	cmd.Flags().IntVar(&opts.workers, "workers", 4, "The number of merge requests fetched concurrently when GraphQL is unavailable")
+	cmd.Flags().BoolVar(&opts.strict, "strict", false, "Fail if any merge request can not be fetched, instead of leaving it out of the release notes")
 	return cmd
 }
 
@@ -49,38 +84,137 @@ type releaseOptions struct {
 	ref     string
 	msg     string
 	dry     bool
+
+	component string
+	workers   int
+	strict    bool
+
+	name       string
+	milestones []string
+	releasedAt string
+	assetSpecs []string
+	assetFile  string
+
+	uploads       []string
+	uploadArgs    []string
+	pkgName       string
+	checksumsFile string
+}
+
+// resolveComponent returns the component of --component or the tag, nil if the tag belongs to no component.
+func (o *releaseOptions) resolveComponent() (*config.Component, error) {
+	if o.component != "" {
+		return o.cfg.GetComponent(o.component)
+	}
+	return o.cfg.ComponentByTag(o.tag), nil
+}
+
+// scopeOf returns the release notes scope of the component, the whole repository if com is nil.
+// Tags of the other components are excluded from both.
+func scopeOf(cfg *config.Config, com *config.Component) releasenote.Scope {
+	var scope releasenote.Scope
+	if com != nil {
+		scope.TagPrefix, scope.Paths = com.TagPrefix, com.Paths
+	}
+	for _, other := range cfg.Components {
+		if other.TagPrefix != "" && (com == nil || other.Name != com.Name) {
+			scope.ExcludeTagPrefixes = append(scope.ExcludeTagPrefixes, other.TagPrefix)
+		}
+	}
+	return scope
 }
 
 func (o *releaseOptions) Run(cmd *cobra.Command, args []string) error {
+	com, err := o.resolveComponent()
+	if err != nil {
+		return err
+	}
+	scope := scopeOf(o.cfg, com)
+	req := gitlab.ReleaseRequest{Name: o.name, Milestones: o.milestones}
+	if o.releasedAt != "" {
+		releasedAt, err := time.Parse(time.RFC3339, o.releasedAt)
+		if err != nil {
+			return fmt.Errorf("invalid --released-at: %v", err)
+		}
+		req.ReleasedAt = &releasedAt
+	}
+	links, err := o.assets()
+	if err != nil {
+		return err
+	}
+	files, err := o.uploadFiles()
+	if err != nil {
+		return err
+	}
+	if _, err = mergeLinks(o.uploadLinks(files), links); err != nil {
+		return err
+	}
 
-	tagExists, result, err := releasenote.GetReleaseNotesByTag(
+	_, notes, err := releasenote.GetReleaseNotesByTag(
 		o.client,
 		o.project,
 		o.tag,
 		o.ref,
+		releasenote.Options{
+			Scope:    scope,
+			Workers:  o.workers,
+			Strict:   o.strict,
+			Progress: progress(cmd.ErrOrStderr()),
+		},
 	)
 	if err != nil {
-		return err
+		return gitlab.DescribeError(err, "generate release notes", gitlab.PermissionRead)
+	}
+	if len(notes.Missing) > 0 {
+		_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "warning: merge requests %s could not be fetched and are left out of the release notes\n",
+			releasenote.FormatIIDs(notes.Missing))
 	}
+	req.Description = notes.Notes
 
 	if o.dry {
-		fmt.Print(result)
+		for _, file := range files {
+			_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "would upload %s\n", file)
+		}
+		fmt.Print(notes.Notes)
 		return nil
 	}
 
-	if tagExists {
-		err = o.client.UpsertRelease(o.project, o.tag, result)
+	if len(files) > 0 {
+		name, err := o.packageName(com)
 		if err != nil {
 			return err
 		}
+		uploaded, err := o.upload(files, name, strings.TrimPrefix(o.tag, scope.TagPrefix))
+		if err != nil {
+			return err
+		}
+		if links, err = mergeLinks(uploaded, links); err != nil {
+			return err
+		}
+	}
+
+	release, err := o.client.GetRelease(o.project, o.tag)
+	if err == gitlab.ErrReleaseNotFound {
+		// the tag is created from ref if it does not exist
+		req.TagName, req.Ref, req.TagMessage = o.tag, o.ref, o.msg
+		req.Assets = &gitlab.ReleaseAssets{Links: links}
+		if _, err = o.client.CreateRelease(o.project, req); err != nil {
+			return gitlab.DescribeError(err, "create release "+o.tag, gitlab.PermissionRelease)
+		}
+	} else if err != nil {
+		return gitlab.DescribeError(err, "get release "+o.tag, gitlab.PermissionRead)
 	} else {
-		tagReq := gitlab.TagRequest{
-			TagName:            o.tag,
-			Ref:                o.ref,
-			Message:            o.msg,
-			ReleaseDescription: result,
+		// the notes are always replaced, even by empty ones
+		update := gitlab.ReleaseUpdate{
+			Name:        req.Name,
+			Description: req.Description,
+			Milestones:  req.Milestones,
+			ReleasedAt:  req.ReleasedAt,
 		}
-		if err = o.client.CreateTag(o.project, tagReq); err != nil {
+		if _, err = o.client.UpdateRelease(o.project, o.tag, update); err != nil {
+			return gitlab.DescribeError(err, "update release "+o.tag, gitlab.PermissionRelease)
+		}
+		if err = o.updateLinks(release, links); err != nil {
 			return err
 		}
 	}
@@ -88,3 +222,15 @@ func (o *releaseOptions) Run(cmd *cobra.Command, args []string) error {
 	fmt.Printf("successfully to release %s\n", o.tag)
 	return nil
 }
+
+// progress reports the fetched merge requests at most every second, releases may have hundreds of them.
+func progress(w io.Writer) func(done, total int) {
+	last := time.Now()
+	return func(done, total int) {
+		if done < total && time.Since(last) < time.Second {
+			return
+		}
+		last = time.Now()
+		_, _ = fmt.Fprintf(w, "fetched %d/%d merge requests\n", done, total)
+	}
+}
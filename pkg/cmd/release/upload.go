@@ -0,0 +1,138 @@
+package release
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"walle/pkg/config"
+	"walle/pkg/gitlab"
+)
+
+// uploadFiles returns the files matched by the glob patterns of --upload and the paths of the arguments,
+// directories are skipped. The checksums file left by a previous run, e.g. in `dist/*`, is not uploaded as a file.
+func (o *releaseOptions) uploadFiles() ([]string, error) {
+	var files []string
+	names := map[string]string{}
+	if o.checksumsFile != "" {
+		names[filepath.Base(o.checksumsFile)] = o.checksumsFile
+	}
+	add := func(file string) error {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// files of a package are identified by their names
+		name := filepath.Base(file)
+		if other, ok := names[name]; ok {
+			if filepath.Clean(other) == filepath.Clean(file) {
+				return nil
+			}
+			return fmt.Errorf("files %s and %s to upload have the same name", other, file)
+		}
+		names[name] = file
+		files = append(files, file)
+		return nil
+	}
+	for _, pattern := range o.uploads {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upload pattern %q: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match the upload pattern %q", pattern)
+		}
+		for _, match := range matches {
+			if err = add(match); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, file := range o.uploadArgs {
+		if err := add(file); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// uploadLinks returns the links of the files to upload and the checksums file, with names only.
+// They are checked against the other links before anything is uploaded.
+func (o *releaseOptions) uploadLinks(files []string) []gitlab.ReleaseLink {
+	if len(files) == 0 {
+		return nil
+	}
+	var links []gitlab.ReleaseLink
+	for _, file := range files {
+		links = append(links, gitlab.ReleaseLink{Name: filepath.Base(file)})
+	}
+	if o.checksumsFile != "" {
+		links = append(links, gitlab.ReleaseLink{Name: filepath.Base(o.checksumsFile)})
+	}
+	return links
+}
+
+// packageName returns the name of the generic package, the component or the project by default.
+func (o *releaseOptions) packageName(com *config.Component) (string, error) {
+	if o.pkgName != "" {
+		return o.pkgName, nil
+	}
+	if com != nil {
+		return com.Name, nil
+	}
+	project, err := o.client.GetProject(o.project)
+	if err != nil {
+		return "", gitlab.DescribeError(err, "get project", gitlab.PermissionRead)
+	}
+	return path.Base(project.PathWithNamespace), nil
+}
+
+// upload uploads the files to the generic package of the version, and writes and uploads the checksums file.
+// The links of the uploaded files are returned.
+func (o *releaseOptions) upload(files []string, name, version string) ([]gitlab.ReleaseLink, error) {
+	var links []gitlab.ReleaseLink
+	var sums strings.Builder
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(&sums, "%x  %s\n", sha256.Sum256(content), filepath.Base(file))
+		link, err := o.uploadFile(name, version, filepath.Base(file), content)
+		if err != nil {
+			return nil, err
+		}
+		link.LinkType = gitlab.LinkTypePackage
+		links = append(links, link)
+	}
+
+	if o.checksumsFile == "" {
+		return links, nil
+	}
+	content := []byte(sums.String())
+	if err := ioutil.WriteFile(o.checksumsFile, content, 0644); err != nil {
+		return nil, err
+	}
+	link, err := o.uploadFile(name, version, filepath.Base(o.checksumsFile), content)
+	if err != nil {
+		return nil, err
+	}
+	link.LinkType = gitlab.LinkTypeOther
+	return append(links, link), nil
+}
+
+func (o *releaseOptions) uploadFile(name, version, fileName string, content []byte) (gitlab.ReleaseLink, error) {
+	url, err := o.client.UploadGenericPackageFile(o.project, name, version, fileName, content)
+	if err != nil {
+		return gitlab.ReleaseLink{}, gitlab.DescribeError(err, "upload "+fileName, gitlab.PermissionWrite)
+	}
+	o.logger.WithField("url", url).Info("Uploaded " + fileName)
+	return gitlab.ReleaseLink{Name: fileName, URL: url}, nil
+}
@@ -5,10 +5,16 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"walle/pkg/ci"
+	"walle/pkg/cmd/cache"
 	"walle/pkg/cmd/changelog"
+	"walle/pkg/cmd/doctor"
+	"walle/pkg/cmd/env"
 	"walle/pkg/cmd/release"
 	"walle/pkg/cmd/version"
+	"walle/pkg/config"
 	"walle/pkg/context"
+	"walle/pkg/gitlab"
 )
 
 func NewCmdRoot(ctx *context.Context, buildVersion, buildDate string) *cobra.Command {
@@ -21,6 +27,9 @@ func NewCmdRoot(ctx *context.Context, buildVersion, buildDate string) *cobra.Com
 	EnablePersistentFlags(ctx, cmd)
 	cmd.AddCommand(release.NewReleaseCmd(ctx))
 	cmd.AddCommand(changelog.NewCmdChangelog(ctx))
+	cmd.AddCommand(doctor.NewCmdDoctor(ctx))
+	cmd.AddCommand(env.NewCmdEnv(ctx))
+	cmd.AddCommand(cache.NewCmdCache(ctx))
 	cmd.AddCommand(version.NewCmdVersion(ctx, buildVersion, buildDate))
 	return cmd
 }
@@ -28,26 +37,145 @@ func NewCmdRoot(ctx *context.Context, buildVersion, buildDate string) *cobra.Com
 func EnablePersistentFlags(ctx *context.Context, cmd *cobra.Command) {
 	cmd.PersistentFlags().StringP("project", "p", "", "project fully name or id")
 	cmd.PersistentFlags().String("token", "", "gitlab token")
+	cmd.PersistentFlags().String("auth-type", "", "how the token is sent, `bearer`, `oauth`, `private-token` or `job-token`. default is bearer")
+	cmd.PersistentFlags().String("token-file", "", "read the token from the file")
+	cmd.PersistentFlags().String("token-command", "", "read the token from the output of the command, e.g. a credential helper")
 	cmd.PersistentFlags().String("host", "", "gitlab host address")
+	cmd.PersistentFlags().String("ca-cert", "", "PEM bundle of additional CA certificates to trust")
+	cmd.PersistentFlags().String("client-cert", "", "PEM client certificate for mutual TLS")
+	cmd.PersistentFlags().String("client-key", "", "PEM client key for mutual TLS")
+	cmd.PersistentFlags().String("proxy", "", "proxy url. default is read from HTTPS_PROXY and HTTP_PROXY")
+	cmd.PersistentFlags().Bool("insecure", false, "skip verification of the server certificate, NOT secure")
+	cmd.PersistentFlags().String("cache-dir", "", "cache GitLab responses in the directory, nothing is cached if it is not set")
+	cmd.PersistentFlags().Bool("no-cache", false, "do not cache GitLab responses on disk")
+	cmd.PersistentFlags().String("config", "", "config file path. default is `.walle.json` if it exists")
 
-	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
-		projectOverride, _ := cmd.Flags().GetString("project")
-		if projectFromEnv := os.Getenv("WALLE_PROJECT"); projectOverride == "" && projectFromEnv != "" {
-			projectOverride = projectFromEnv
+	cmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		ctx.Sources = map[string]string{}
+		ctx.CI = ci.Detect()
+		ciEnv := ctx.CI
+		if ciEnv == nil {
+			ciEnv = &ci.Env{}
 		}
-		if projectOverride != "" {
-			ctx.Project = projectOverride
+
+		configFile := pick(ctx, "config", fromFlag(cmd, "config"), fromEnv("WALLE_CONFIG"))
+		explicitConfig := configFile != ""
+		defaultHost := ctx.Config.Host
+		ctx.Config.Host = ""
+		if configFile != "" {
+			if err := ctx.Config.LoadFile(configFile, true); err != nil {
+				return err
+			}
+		} else {
+			if err := ctx.Config.LoadFile(config.DefaultConfigFile, false); err != nil {
+				return err
+			}
+			configFile = config.DefaultConfigFile
+		}
+		fromFile := func(value string) candidate {
+			return candidate{value, "config file " + configFile}
+		}
+		// the config file found in the working directory belongs to the repository, e.g. of a merge request,
+		// settings which could run commands or leak the token are read only from files given explicitly.
+		fromExplicitFile := func(key, value string) candidate {
+			if value != "" && !explicitConfig {
+				ctx.Logger.Warnf("Ignoring %s in %s, pass the file by --config or WALLE_CONFIG to use it", key, configFile)
+				return candidate{}
+			}
+			return fromFile(value)
+		}
+
+		if project := pick(ctx, "project", fromFlag(cmd, "project"), fromEnv("WALLE_PROJECT"),
+			fromCI(ciEnv.Project, "CI_PROJECT_PATH")); project != "" {
+			ctx.Project = project
+		}
+
+		ctx.Config.Token = pick(ctx, "token", fromFlag(cmd, "token"), fromEnv("WALLE_GITLAB_TOKEN"))
+		ctx.Config.AuthType = pick(ctx, "auth-type", fromFlag(cmd, "auth-type"), fromEnv("WALLE_AUTH_TYPE"), fromFile(ctx.Config.AuthType))
+		ctx.Config.TokenFile = pick(ctx, "token-file", fromFlag(cmd, "token-file"), fromEnv("WALLE_GITLAB_TOKEN_FILE"),
+			fromExplicitFile("token_file", ctx.Config.TokenFile))
+		ctx.Config.TokenCommand = pick(ctx, "token-command", fromFlag(cmd, "token-command"), fromEnv("WALLE_GITLAB_TOKEN_COMMAND"),
+			fromExplicitFile("token_command", ctx.Config.TokenCommand))
+		if err := gitlab.ValidateAuthType(ctx.Config.AuthType); err != nil {
+			return err
+		}
+		source, err := ctx.Config.ResolveToken()
+		if err != nil {
+			return err
+		}
+		if source != "" && ctx.Config.Token != "" {
+			ctx.Sources["token"] = source
+		}
+		// the job token is used in CI if no other token is given.
+		if ctx.Config.Token == "" && ctx.Config.AuthType == "" && ciEnv.JobToken != "" {
+			ctx.Config.Token = ciEnv.JobToken
+			ctx.Config.AuthType = gitlab.AuthJobToken
+			ctx.Sources["token"] = "GitLab CI CI_JOB_TOKEN"
+			ctx.Sources["auth-type"] = "GitLab CI"
+		}
+
+		// a proxy, or a CA trusted by the proxy, could read the token as well
+		ctx.Config.CACert = pick(ctx, "ca-cert", fromFlag(cmd, "ca-cert"), fromEnv("WALLE_GITLAB_CA_CERT"),
+			fromExplicitFile("ca_cert", ctx.Config.CACert))
+		ctx.Config.ClientCert = pick(ctx, "client-cert", fromFlag(cmd, "client-cert"), fromEnv("WALLE_GITLAB_CLIENT_CERT"),
+			fromExplicitFile("client_cert", ctx.Config.ClientCert))
+		ctx.Config.ClientKey = pick(ctx, "client-key", fromFlag(cmd, "client-key"), fromEnv("WALLE_GITLAB_CLIENT_KEY"),
+			fromExplicitFile("client_key", ctx.Config.ClientKey))
+		ctx.Config.Proxy = pick(ctx, "proxy", fromFlag(cmd, "proxy"), fromEnv("WALLE_PROXY"), fromExplicitFile("proxy", ctx.Config.Proxy))
+		// WALLE_GITLAB_INSECURE is the former name of WALLE_INSECURE.
+		if insecure, _ := cmd.Flags().GetBool("insecure"); insecure || os.Getenv("WALLE_INSECURE") == "true" ||
+			os.Getenv("WALLE_GITLAB_INSECURE") == "true" {
+			ctx.Config.InsecureSkipVerify = true
+		}
+
+		// the cache keeps responses of private projects, it is only enabled explicitly
+		ctx.Config.CacheDir = pick(ctx, "cache-dir", fromFlag(cmd, "cache-dir"), fromEnv("WALLE_CACHE_DIR"),
+			fromExplicitFile("cache_dir", ctx.Config.CacheDir))
+		if noCache, _ := cmd.Flags().GetBool("no-cache"); noCache || os.Getenv("WALLE_NO_CACHE") == "true" {
+			ctx.Config.NoCache = true
 		}
 
-		tokenOverride, _ := cmd.Flags().GetString("token")
-		if tokenFromEnv := os.Getenv("WALLE_GITLAB_TOKEN"); tokenFromEnv != "" && tokenOverride == "" {
-			tokenOverride = tokenFromEnv
+		ctx.Config.Cassette = os.Getenv("WALLE_CASSETTE")
+		ctx.Config.CassetteMode = os.Getenv("WALLE_CASSETTE_MODE")
+		if err := gitlab.ValidateCassetteMode(ctx.Config.CassetteMode); err != nil {
+			return err
 		}
-		ctx.Config.Token = tokenOverride
 
-		host, _ := cmd.Flags().GetString("host")
-		if host != "" {
-			ctx.Config.Host = host
+		ctx.Config.Host = pick(ctx, "host", fromFlag(cmd, "host"), fromEnv("WALLE_GITLAB_HOST"), fromExplicitFile("host", ctx.Config.Host),
+			fromCI(ciEnv.Host, "CI_SERVER_URL"), candidate{defaultHost, "default"})
+
+		pick(ctx, "ref", fromCI(ciEnv.Ref, "CI_COMMIT_SHA"))
+		pick(ctx, "tag", fromCI(ciEnv.Tag, "CI_COMMIT_TAG"))
+		return nil
+	}
+}
+
+// candidate is a value of a setting and where it is read from.
+type candidate struct {
+	value  string
+	source string
+}
+
+func fromFlag(cmd *cobra.Command, name string) candidate {
+	value, _ := cmd.Flags().GetString(name)
+	return candidate{value, "flag --" + name}
+}
+
+func fromEnv(name string) candidate {
+	return candidate{os.Getenv(name), "env " + name}
+}
+
+func fromCI(value, name string) candidate {
+	return candidate{value, "GitLab CI " + name}
+}
+
+// pick returns the first non-empty candidate and records its source, candidates are in order of precedence.
+func pick(ctx *context.Context, setting string, candidates ...candidate) string {
+	for _, c := range candidates {
+		if c.value != "" {
+			ctx.Sources[setting] = c.source
+			return c.value
 		}
 	}
+	return ""
 }
@@ -0,0 +1,170 @@
+package root
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"walle/pkg/config"
+	"walle/pkg/context"
+	"walle/pkg/gitlab"
+)
+
+// run runs a command with the persistent flags in the directory, and returns the resolved config.
+func run(t *testing.T, dir string, args ...string) *config.Config {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(wd) }()
+
+	cfg := config.LoadConfig()
+	ctx := context.NewContext(nil, &cfg, logrus.NewEntry(logrus.New()))
+	cmd := &cobra.Command{Use: "walle", RunE: func(*cobra.Command, []string) error { return nil }}
+	EnablePersistentFlags(&ctx, cmd)
+	cmd.SetArgs(args)
+	if err = cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+	return &cfg
+}
+
+func TestAutoLoadedConfigFile(t *testing.T) {
+	for _, name := range []string{"GITLAB_CI", "WALLE_CONFIG", "WALLE_PROXY", "WALLE_GITLAB_CA_CERT", "WALLE_GITLAB_HOST", "WALLE_CACHE_DIR"} {
+		if value, ok := os.LookupEnv(name); ok {
+			_ = os.Unsetenv(name)
+			defer os.Setenv(name, value)
+		}
+	}
+	dir := t.TempDir()
+	content := `{
+  "host": "https://gitlab.attacker.example",
+  "proxy": "http://proxy.attacker.example:3128",
+  "ca_cert": "attacker-ca.pem",
+  "client_cert": "client.pem",
+  "client_key": "client-key.pem",
+  "token_command": "cat ~/.token",
+  "cache_dir": "/tmp/walle-cache",
+  "changelog_format": "keepachangelog"
+}`
+	if err := ioutil.WriteFile(filepath.Join(dir, config.DefaultConfigFile), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := run(t, dir)
+	if cfg.Proxy != "" || cfg.CACert != "" || cfg.ClientCert != "" || cfg.ClientKey != "" || cfg.TokenCommand != "" {
+		t.Errorf("got proxy %q, ca cert %q, client cert %q, client key %q, token command %q from the auto-loaded file, want them ignored",
+			cfg.Proxy, cfg.CACert, cfg.ClientCert, cfg.ClientKey, cfg.TokenCommand)
+	}
+	if cfg.Host != "http://gitlab.com" || cfg.CacheDir == "/tmp/walle-cache" {
+		t.Errorf("got host %q and cache dir %q from the auto-loaded file, want them ignored", cfg.Host, cfg.CacheDir)
+	}
+	if cfg.ChangelogFormat != "keepachangelog" {
+		t.Errorf("got changelog format %q, want other settings read", cfg.ChangelogFormat)
+	}
+
+	cfg = run(t, dir, "--config", config.DefaultConfigFile, "--token", "secret")
+	if cfg.Proxy != "http://proxy.attacker.example:3128" || cfg.CACert != "attacker-ca.pem" || cfg.Host != "https://gitlab.attacker.example" {
+		t.Errorf("got proxy %q, ca cert %q and host %q, want them read from the explicit file", cfg.Proxy, cfg.CACert, cfg.Host)
+	}
+}
+
+func TestCacheIsOptIn(t *testing.T) {
+	if value, ok := os.LookupEnv("WALLE_CACHE_DIR"); ok {
+		_ = os.Unsetenv("WALLE_CACHE_DIR")
+		defer os.Setenv("WALLE_CACHE_DIR", value)
+	}
+	dir := t.TempDir()
+	if cfg := run(t, dir); cfg.GetCacheDir() != "" {
+		t.Errorf("got cache dir %q by default, want no cache", cfg.GetCacheDir())
+	}
+	cacheDir := filepath.Join(dir, "cache")
+	if cfg := run(t, dir, "--cache-dir", cacheDir); cfg.GetCacheDir() != cacheDir {
+		t.Errorf("got cache dir %q, want %q of --cache-dir", cfg.GetCacheDir(), cacheDir)
+	}
+	if cfg := run(t, dir, "--cache-dir", cacheDir, "--no-cache"); cfg.GetCacheDir() != "" {
+		t.Errorf("got cache dir %q with --no-cache, want no cache", cfg.GetCacheDir())
+	}
+}
+
+// setEnv sets the environment variable for the test, an empty value unsets it.
+func setEnv(t *testing.T, name, value string) {
+	old, ok := os.LookupEnv(name)
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(name, old)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	})
+	if value == "" {
+		_ = os.Unsetenv(name)
+	} else {
+		_ = os.Setenv(name, value)
+	}
+}
+
+func TestAuthTypes(t *testing.T) {
+	for _, name := range []string{"WALLE_GITLAB_TOKEN", "WALLE_AUTH_TYPE", "WALLE_CONFIG", "WALLE_GITLAB_HOST", "CI_SERVER_URL"} {
+		setEnv(t, name, "")
+	}
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		_, _ = w.Write([]byte(`{"version": "15.11.0"}`))
+	}))
+	defer server.Close()
+
+	testcases := []struct {
+		args        []string
+		ci          bool
+		name, value string
+	}{
+		{args: []string{"--token", "secret"}, name: "Authorization", value: "Bearer secret"},
+		{args: []string{"--token", "secret", "--auth-type", "oauth"}, name: "Authorization", value: "Bearer secret"},
+		{args: []string{"--token", "secret", "--auth-type", "private-token"}, name: "PRIVATE-TOKEN", value: "secret"},
+		{args: []string{"--token", "secret", "--auth-type", "job-token"}, name: "JOB-TOKEN", value: "secret"},
+		// the job token is the default in CI, a given token wins
+		{ci: true, name: "JOB-TOKEN", value: "job"},
+		{args: []string{"--token", "secret"}, ci: true, name: "Authorization", value: "Bearer secret"},
+	}
+	for _, tc := range testcases {
+		if tc.ci {
+			setEnv(t, "GITLAB_CI", "true")
+			setEnv(t, "CI_JOB_TOKEN", "job")
+		} else {
+			setEnv(t, "GITLAB_CI", "")
+			setEnv(t, "CI_JOB_TOKEN", "")
+		}
+		cfg := config.LoadConfig()
+		ctx := context.NewContext(nil, &cfg, logrus.NewEntry(logrus.New()))
+		ctx.GitLabClient = gitlab.NewClient(ctx.Logger, &cfg)
+		cmd := &cobra.Command{Use: "walle", RunE: func(*cobra.Command, []string) error {
+			_, err := ctx.GitLabClient.GetVersion()
+			return err
+		}}
+		EnablePersistentFlags(&ctx, cmd)
+		header = nil
+		cmd.SetArgs(append([]string{"--host", server.URL}, tc.args...))
+		if err := cmd.Execute(); err != nil {
+			t.Fatal(err)
+		}
+		if got := header.Get(tc.name); got != tc.value {
+			t.Errorf("%v in CI %v: got %s header %q, want %q", tc.args, tc.ci, tc.name, got, tc.value)
+		}
+		for _, other := range []string{"Authorization", "PRIVATE-TOKEN", "JOB-TOKEN"} {
+			if other != tc.name && header.Get(other) != "" {
+				t.Errorf("%v in CI %v: got %s header sent too", tc.args, tc.ci, other)
+			}
+		}
+	}
+}
@@ -19,10 +19,6 @@ func main() {
 
 	cfg := config.LoadConfig()
 
-	if hostFromEnv := os.Getenv("WALLE_GITLAB_HOST"); hostFromEnv != "" {
-		cfg.Host = hostFromEnv
-	}
-
 	logger := logrus.WithField("client", "walle")
 	client := gitlab.NewClient(logger, &cfg)
 	ctx := context.NewContext(client, &cfg, logger)
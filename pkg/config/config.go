@@ -1,14 +1,92 @@
 package config
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"walle/pkg/gitlab"
+)
 
 var (
 	defaultHost = "http://gitlab.com"
+
+	DefaultConfigFile = ".walle.json"
 )
 
+// Config is the settings of walle. Settings which could run commands or leak the token, like Host, Proxy and TokenCommand,
+// are ignored in the config file found in the working directory, which belongs to the repository.
 type Config struct {
-	Host  string
-	Token string
+	Host  string `json:"host"`
+	Token string `json:"-"`
+	// AuthType is how the token is sent, one of `bearer`, `oauth`, `private-token` and `job-token`.
+	AuthType string `json:"auth_type"`
+	// TokenFile is read for the token if no token is given.
+	TokenFile string `json:"token_file"`
+	// TokenCommand is run by the shell for the token if no token is given, e.g. a credential helper.
+	TokenCommand string `json:"token_command"`
+
+	// CACert is a PEM bundle trusted in addition to the system roots, e.g. an internal CA.
+	CACert string `json:"ca_cert"`
+	// ClientCert and ClientKey are the PEM certificate and key for mutual TLS.
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+	// Proxy overrides the HTTPS_PROXY and HTTP_PROXY environment variables.
+	Proxy string `json:"proxy"`
+	// InsecureSkipVerify disables the verification of the server certificate, it is set by the flag or env only.
+	InsecureSkipVerify bool `json:"-"`
+
+	// CacheDir caches GET responses, default is `walle` in the user cache directory.
+	// Responses of a token are written there, so it is ignored in the config file of the working directory.
+	CacheDir string `json:"cache_dir"`
+	NoCache  bool   `json:"-"`
+
+	// Cassette is the file recording the API exchanges, or replaying them in CassetteMode `replay`.
+	Cassette     string `json:"-"`
+	CassetteMode string `json:"-"`
+
+	// Components splits a monorepo into independently released parts.
+	Components []Component `json:"components"`
+	// ChangelogFormat is the format of changelog files, `walle` or `keepachangelog`.
+	ChangelogFormat string `json:"changelog_format"`
+	// ChangelogOrder sorts versions of changelog files by `semver` or `date`.
+	ChangelogOrder string `json:"changelog_order"`
+	// VersionFiles are updated to the released version of tags not belonging to any component.
+	VersionFiles []VersionFile `json:"version_files"`
+}
+
+// VersionFile is a file containing the version string, e.g. `package.json`.
+type VersionFile struct {
+	Path string `json:"path"`
+	// Type is one of json, yaml, go and regex, detected by the file extension if it is empty.
+	Type string `json:"type"`
+	// Key is the dotted path of json and yaml files, or the variable name of go files.
+	Key string `json:"key"`
+	// Pattern is the regular expression of the regex type, its first group is replaced by the version.
+	Pattern string `json:"pattern"`
+	// Prefix is prepended to the version, e.g. `v`.
+	Prefix string `json:"prefix"`
+}
+
+// Component is a part of a monorepo which has its own tags and release notes.
+type Component struct {
+	Name string `json:"name"`
+	// TagPrefix is prepended to the version of the component, e.g. `api/`.
+	TagPrefix string `json:"tag_prefix"`
+	// Paths are glob patterns of the files belonging to the component. `**` matches any directories.
+	Paths []string `json:"paths"`
+	// Changelog is the changelog file of the component.
+	Changelog string `json:"changelog"`
+	// VersionFiles are updated to the released version of the component.
+	VersionFiles []VersionFile `json:"version_files"`
+}
+
+// TrimTagPrefix returns the version part of a component tag.
+func (c *Component) TrimTagPrefix(tag string) string {
+	return strings.TrimPrefix(tag, c.TagPrefix)
 }
 
 func (c *Config) GetAPIBase() string {
@@ -18,6 +96,113 @@ func (c *Config) GetAPIBase() string {
 func (c *Config) GetToken() string {
 	return c.Token
 }
+
+func (c *Config) GetAuthType() string {
+	return c.AuthType
+}
+
+func (c *Config) GetCACert() string {
+	return c.CACert
+}
+
+func (c *Config) GetClientCert() string {
+	return c.ClientCert
+}
+
+func (c *Config) GetClientKey() string {
+	return c.ClientKey
+}
+
+func (c *Config) GetProxy() string {
+	return c.Proxy
+}
+
+func (c *Config) GetInsecureSkipVerify() bool {
+	return c.InsecureSkipVerify
+}
+
+func (c *Config) GetCacheDir() string {
+	if c.NoCache {
+		return ""
+	}
+	return c.CacheDir
+}
+
+func (c *Config) GetCassette() (string, string) {
+	return c.Cassette, c.CassetteMode
+}
+
+// ResolveToken loads the token from the token file or the token command if no token is given.
+// CI_JOB_TOKEN is used for the job-token auth type. The source of the loaded token is returned.
+func (c *Config) ResolveToken() (string, error) {
+	switch {
+	case c.Token != "":
+		return "", nil
+	case c.TokenFile != "":
+		b, err := ioutil.ReadFile(c.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file: %v", err)
+		}
+		c.Token = strings.TrimSpace(string(b))
+		return "token file " + c.TokenFile, nil
+	case c.TokenCommand != "":
+		cmd := exec.Command("sh", "-c", c.TokenCommand)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("failed to run token command: %v", err)
+		}
+		c.Token = strings.TrimSpace(string(out))
+		return "token command", nil
+	case c.AuthType == gitlab.AuthJobToken:
+		c.Token = os.Getenv("CI_JOB_TOKEN")
+		return "env CI_JOB_TOKEN", nil
+	}
+	return "", nil
+}
+
+// GetComponent returns the component with the name.
+func (c *Config) GetComponent(name string) (*Component, error) {
+	for i := range c.Components {
+		if c.Components[i].Name == name {
+			return &c.Components[i], nil
+		}
+	}
+	return nil, fmt.Errorf("component %q is not defined", name)
+}
+
+// ComponentByTag returns the component whose tag prefix matches the tag.
+// The longest prefix wins, nil is returned if no component matches.
+func (c *Config) ComponentByTag(tag string) *Component {
+	var matched *Component
+	for i := range c.Components {
+		com := &c.Components[i]
+		if com.TagPrefix == "" || !strings.HasPrefix(tag, com.TagPrefix) {
+			continue
+		}
+		if matched == nil || len(com.TagPrefix) > len(matched.TagPrefix) {
+			matched = com
+		}
+	}
+	return matched
+}
+
+// LoadFile merges the json config file into the config.
+// A missing file is ignored unless required is true.
+func (c *Config) LoadFile(path string, required bool) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
 func LoadConfig() Config {
 	return Config{
 		Host: defaultHost,
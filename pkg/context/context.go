@@ -3,6 +3,7 @@ package context
 import (
 	"github.com/sirupsen/logrus"
 
+	"walle/pkg/ci"
 	"walle/pkg/config"
 	"walle/pkg/gitlab"
 )
@@ -13,6 +14,11 @@ type Context struct {
 	Config  *config.Config
 	Logger  *logrus.Entry
 	Project string
+
+	// CI is the detected CI environment, nil if not running in CI.
+	CI *ci.Env
+	// Sources records where each setting is read from, e.g. `flag --host`.
+	Sources map[string]string
 }
 
 func NewContext(client gitlab.Client, config *config.Config, logger *logrus.Entry) Context {
@@ -0,0 +1,203 @@
+package gitlab
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// commitRe matches a commit, or the commits of a ref, by its full SHA.
+	commitRe = regexp.MustCompile(`/repository/commits(/[0-9a-f]{40}$|\?(.*&)?ref_name=[0-9a-f]{40}(&|$))`)
+	// mergeRequestRe matches a merge request or its changes.
+	mergeRequestRe = regexp.MustCompile(`/merge_requests/\d+(/changes)?$`)
+	// cacheFileRe matches the entries and the temporary files written by writeCacheEntry.
+	cacheFileRe = regexp.MustCompile(`^([0-9a-f]{64}\.json|\d+\.walle-tmp)$`)
+)
+
+// CacheConfig is implemented by configs which cache GET responses on disk.
+type CacheConfig interface {
+	// GetCacheDir returns the directory of the cache, empty if disabled.
+	GetCacheDir() string
+}
+
+// cacheEntry is a response saved in the cache.
+type cacheEntry struct {
+	URL    string            `json:"url"`
+	ETag   string            `json:"etag"`
+	Header map[string]string `json:"header"`
+	Body   string            `json:"body"`
+	// Immutable responses are used without asking GitLab, e.g. merged merge requests.
+	Immutable bool `json:"immutable"`
+}
+
+// cacheClient caches the successful GET responses of the client it wraps, revalidating them with their ETag.
+type cacheClient struct {
+	client      httpClient
+	getCacheDir func() string
+	getToken    func() string
+}
+
+func (c *cacheClient) Do(req *http.Request) (*http.Response, error) {
+	dir := c.getCacheDir()
+	if dir == "" || req.Method != http.MethodGet {
+		return c.client.Do(req)
+	}
+
+	path := filepath.Join(dir, c.key(req.URL.String())+".json")
+	entry := readCacheEntry(path)
+	if entry != nil && entry.Immutable {
+		return entry.response(req), nil
+	}
+	if entry != nil && entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		_ = resp.Body.Close()
+		return entry.response(req), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	entry = &cacheEntry{
+		URL:       req.URL.String(),
+		ETag:      resp.Header.Get("ETag"),
+		Header:    map[string]string{},
+		Body:      string(b),
+		Immutable: immutable(req.URL.RequestURI(), b),
+	}
+	if entry.ETag == "" && !entry.Immutable {
+		return resp, nil
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			entry.Header[name] = value
+		}
+	}
+	// the cache is only an optimization, failing to write it is not an error
+	_ = writeCacheEntry(path, entry)
+	return resp, nil
+}
+
+// key identifies the URL and the token, so users sharing a cache directory do not see the responses of others.
+func (c *cacheClient) key(url string) string {
+	var token string
+	if c.getToken != nil {
+		token = c.getToken()
+	}
+	tokenSum := sha256.Sum256([]byte(token))
+	sum := sha256.Sum256([]byte(url + "\n" + hex.EncodeToString(tokenSum[:])))
+	return hex.EncodeToString(sum[:])
+}
+
+// immutable returns true for merged merge requests and commits by SHA, they never change.
+func immutable(uri string, body []byte) bool {
+	if commitRe.MatchString(uri) {
+		return true
+	}
+	if path := strings.SplitN(uri, "?", 2)[0]; mergeRequestRe.MatchString(path) {
+		mr := struct {
+			State string `json:"state"`
+		}{}
+		return json.Unmarshal(body, &mr) == nil && mr.State == "merged"
+	}
+	return false
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{},
+		Body:          ioutil.NopCloser(strings.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+	for name, value := range e.Header {
+		resp.Header.Set(name, value)
+	}
+	return resp
+}
+
+func readCacheEntry(path string) *cacheEntry {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	entry := &cacheEntry{}
+	if err = json.Unmarshal(b, entry); err != nil {
+		return nil
+	}
+	return entry
+}
+
+// writeCacheEntry writes the entry to a temporary file first, so concurrent readers never see a partial entry.
+func writeCacheEntry(path string, entry *cacheEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "*.walle-tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ClearCache removes the cache entries in the directory and returns how many files are removed.
+// Other files and the directory itself are kept, the directory may be shared, e.g. `~/.cache`.
+func ClearCache(dir string) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var removed int
+	for _, f := range files {
+		if !f.Mode().IsRegular() || !cacheFileRe.MatchString(f.Name()) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
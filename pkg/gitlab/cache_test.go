@@ -0,0 +1,95 @@
+package gitlab_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+type cacheConfig struct {
+	gitlabtest.Config
+	dir string
+}
+
+func (c *cacheConfig) GetCacheDir() string {
+	return c.dir
+}
+
+func TestCache(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	merged := p.Merge(gitlab.MergeRequest{Title: "feat: merged"}, nil)
+	cfg := &cacheConfig{Config: *s.Config(), dir: t.TempDir()}
+
+	for i := 0; i < 2; i++ {
+		client := gitlab.NewClient(logrus.NewEntry(logrus.New()), cfg)
+		mr, err := client.GetMergeRequest("group/app", merged.IID)
+		if err != nil || mr.Title != "feat: merged" {
+			t.Fatalf("got merge request %v, %v", mr, err)
+		}
+		project, err := client.GetProject("group/app")
+		if err != nil || project.PathWithNamespace != "group/app" {
+			t.Fatalf("got project %v, %v", project, err)
+		}
+	}
+	expected := []string{
+		"GET /projects/group/app/merge_requests/1",
+		"GET /projects/group/app",
+		// the merged merge request is immutable, the project is revalidated
+		"GET /projects/group/app",
+	}
+	if got := s.Requests(); strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("got requests %v, want %v", got, expected)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	// the cache directory is shared with other programs
+	dir := t.TempDir()
+	cfg := &cacheConfig{Config: *s.Config(), dir: dir}
+	foreign := []string{"other.json", "notes.txt", filepath.Join("other", "data.json")}
+	for _, name := range foreign {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte("keep"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := gitlab.NewClient(logrus.NewEntry(logrus.New()), cfg)
+	if _, err := client.GetProject("group/app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetVersion(); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := gitlab.ClearCache(dir)
+	if err != nil || removed != 2 {
+		t.Fatalf("got %d removed, %v, want the 2 cached responses removed", removed, err)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 3 {
+		t.Errorf("got %d files left, want the 3 foreign ones", len(files))
+	}
+	for _, name := range foreign {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != "keep" {
+			t.Errorf("got %q, %v of %s, want it kept", b, err, name)
+		}
+	}
+	if removed, err = gitlab.ClearCache(filepath.Join(dir, "missing")); err != nil || removed != 0 {
+		t.Errorf("got %d, %v for a missing directory", removed, err)
+	}
+}
@@ -0,0 +1,204 @@
+package gitlab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// CassetteRecord saves the requests and their responses to the cassette.
+	CassetteRecord = "record"
+	// CassetteReplay serves the responses from the cassette without connecting to GitLab.
+	CassetteReplay = "replay"
+
+	redacted = "REDACTED"
+)
+
+// recordedHeaders are the response headers saved to cassettes, others like cookies are dropped.
+var recordedHeaders = []string{
+	"Content-Type", "Link", "ETag",
+	"X-Page", "X-Per-Page", "X-Total", "X-Total-Pages", "X-Next-Page", "X-Prev-Page",
+	"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+}
+
+// CassetteConfig is implemented by configs which record or replay the API exchanges, see CassetteRecord.
+type CassetteConfig interface {
+	// GetCassette returns the path and the mode of the cassette, the path is empty if disabled.
+	GetCassette() (path, mode string)
+}
+
+// ValidateCassetteMode returns an error if the mode is unknown, empty is CassetteReplay.
+func ValidateCassetteMode(mode string) error {
+	switch mode {
+	case "", CassetteRecord, CassetteReplay:
+		return nil
+	}
+	return fmt.Errorf("unknown cassette mode %q, should be %s or %s", mode, CassetteRecord, CassetteReplay)
+}
+
+// cassette is a file of API exchanges, responses are matched by the method, the path with query and the body.
+// The host is not saved, so cassettes recorded against one GitLab can be replayed for any host.
+type cassette struct {
+	Interactions []*interaction `json:"interactions"`
+}
+
+type interaction struct {
+	Method string            `json:"method"`
+	URI    string            `json:"uri"`
+	Body   string            `json:"body,omitempty"`
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	// Response is the response body.
+	Response string `json:"response"`
+
+	replayed bool
+}
+
+// cassetteClient records or replays the requests of the client it wraps.
+type cassetteClient struct {
+	client      httpClient
+	getCassette func() (string, string)
+	getToken    func() string
+
+	once     sync.Once
+	mu       sync.Mutex
+	path     string
+	mode     string
+	cassette *cassette
+	err      error
+}
+
+func (c *cassetteClient) load() {
+	c.path, c.mode = c.getCassette()
+	if c.path == "" {
+		return
+	}
+	if c.mode == "" {
+		c.mode = CassetteReplay
+	}
+	c.cassette = &cassette{}
+	if c.mode == CassetteRecord {
+		return
+	}
+	b, err := ioutil.ReadFile(c.path)
+	if err != nil {
+		c.err = fmt.Errorf("failed to read cassette: %v", err)
+		return
+	}
+	if err = json.Unmarshal(b, c.cassette); err != nil {
+		c.err = fmt.Errorf("failed to parse cassette %s: %v", c.path, err)
+	}
+}
+
+func (c *cassetteClient) Do(req *http.Request) (*http.Response, error) {
+	c.once.Do(c.load)
+	if c.err != nil {
+		return nil, &configError{c.err}
+	}
+	if c.path == "" {
+		return c.client.Do(req)
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		r, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		if body, err = ioutil.ReadAll(r); err != nil {
+			return nil, err
+		}
+	}
+	uri := c.redact(req.URL.RequestURI())
+	if c.mode == CassetteReplay {
+		return c.replay(req, uri, c.redact(string(body)))
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	i := &interaction{
+		Method:   req.Method,
+		URI:      uri,
+		Body:     c.redact(string(body)),
+		Status:   resp.StatusCode,
+		Header:   map[string]string{},
+		Response: c.redact(string(b)),
+	}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			i.Header[name] = c.redact(value)
+		}
+	}
+	if err = c.save(i); err != nil {
+		return nil, &configError{err}
+	}
+	return resp, nil
+}
+
+// replay returns the first response not replayed yet for the request.
+func (c *cassetteClient) replay(req *http.Request, uri, body string) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, i := range c.cassette.Interactions {
+		if i.replayed || i.Method != req.Method || i.URI != uri || i.Body != body {
+			continue
+		}
+		i.replayed = true
+		resp := &http.Response{
+			Status:        fmt.Sprintf("%d %s", i.Status, http.StatusText(i.Status)),
+			StatusCode:    i.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          ioutil.NopCloser(strings.NewReader(i.Response)),
+			ContentLength: int64(len(i.Response)),
+			Request:       req,
+		}
+		for name, value := range i.Header {
+			resp.Header.Set(name, value)
+		}
+		return resp, nil
+	}
+	return nil, &configError{fmt.Errorf("no response recorded in cassette %s for %s %s", c.path, req.Method, uri)}
+}
+
+// save appends the interaction and writes the cassette, so it is kept if walle fails later.
+func (c *cassetteClient) save(i *interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cassette.Interactions = append(c.cassette.Interactions, i)
+	b, err := json.MarshalIndent(c.cassette, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(c.path, b, 0600); err != nil {
+		return fmt.Errorf("failed to write cassette: %v", err)
+	}
+	return nil
+}
+
+// redact hides the token, it is never saved.
+func (c *cassetteClient) redact(s string) string {
+	if c.getToken == nil {
+		return s
+	}
+	if token := c.getToken(); token != "" {
+		s = strings.ReplaceAll(s, token, redacted)
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+package gitlab_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+type cassetteConfig struct {
+	gitlabtest.Config
+	path, mode string
+}
+
+func (c *cassetteConfig) GetCassette() (string, string) {
+	return c.path, c.mode
+}
+
+func TestCassetteRecordReplay(t *testing.T) {
+	s := gitlabtest.NewServer()
+	s.Token = "glpat-secret"
+	s.MaxPerPage = 1
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Tag("v1.0.0", "master")
+	p.Commit("master", "fix: something", nil)
+	p.Tag("v1.0.1", "master")
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	logger := logrus.NewEntry(logrus.New())
+	record := &cassetteConfig{Config: *s.Config(), path: path, mode: gitlab.CassetteRecord}
+	recorded, err := gitlab.NewClient(logger, record).ListTags("group/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), s.Token) {
+		t.Errorf("the token is saved in the cassette:\n%s", b)
+	}
+
+	replay := &cassetteConfig{
+		Config: gitlabtest.Config{APIBase: "https://gitlab.invalid/api/v4", Token: "another"},
+		path:   path,
+		mode:   gitlab.CassetteReplay,
+	}
+	client := gitlab.NewClient(logger, replay)
+	replayed, err := client.ListTags("group/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replayed) != 2 || replayed[0].Name != recorded[0].Name || replayed[1].Name != recorded[1].Name {
+		t.Errorf("got replayed tags %v, want %v", replayed, recorded)
+	}
+	if _, err = client.GetProject("group/app"); err == nil || !strings.Contains(err.Error(), "no response recorded") {
+		t.Errorf("got %v, want an error for a request not recorded", err)
+	}
+}
@@ -25,17 +25,23 @@ const (
 	defaultMaxRetries      = 8
 	defaultMaxInitialDelay = 2 * time.Second
 	defaultMaxSleepTime    = 2 * time.Minute
+	defaultPageWorkers     = 4
 
 	datetimeFormat = time.RFC3339
 )
 
 type timeClient interface {
+	Now() time.Time
 	Sleep(time.Duration)
 	Until(time.Time) time.Duration
 }
 
 type standardTime struct{}
 
+func (s *standardTime) Now() time.Time {
+	return time.Now()
+}
+
 func (s *standardTime) Sleep(d time.Duration) {
 	time.Sleep(d)
 }
@@ -46,27 +52,57 @@ func (s *standardTime) Until(t time.Time) time.Duration {
 
 type MergeRequestClient interface {
 	GetMergeRequest(project string, iid int) (*MergeRequest, error)
+	GetMergeRequestChanges(project string, iid int) ([]MergeRequestChange, error)
 	CreateMergeRequest(project string, req MergeRequestRequest) (*MergeRequest, error)
+	UpdateMergeRequest(project string, iid int, req MergeRequestUpdate) (*MergeRequest, error)
+	FindMergeRequests(project string, query MergeRequestQuery) ([]MergeRequest, error)
 	AcceptMR(project string, mrid int) (*MergeRequest, error)
 	ListMergeRequests(project string, updatedAfter time.Time) ([]MergeRequest, error)
+	ListMergeRequestsByIID(project string, iids []int, withChanges bool) ([]MergeRequestWithChanges, error)
 }
 
 type TagClient interface {
 	GetTag(project, tagName string) (Tag, error)
 	ListTags(project string) ([]Tag, error)
+	// WalkTags calls fn with the tags page by page, the newest first, until fn returns false.
+	WalkTags(project string, opts ListOptions, fn func(tags []Tag, page Page) bool) error
 	CreateTag(project string, req TagRequest) error
-	UpsertRelease(project string, tag, desc string) error
+
+	// Releases are managed by the Releases API, or the release of tags on GitLab older than 11.7.
+	GetRelease(project, tagName string) (*Release, error)
+	ListReleases(project string) ([]Release, error)
+	CreateRelease(project string, req ReleaseRequest) (*Release, error)
+	UpdateRelease(project, tagName string, req ReleaseUpdate) (*Release, error)
+	DeleteRelease(project, tagName string) error
+	CreateReleaseLink(project, tagName string, link ReleaseLink) (*ReleaseLink, error)
+	UpdateReleaseLink(project, tagName string, link ReleaseLink) (*ReleaseLink, error)
 }
 
 type RepoClient interface {
 	GetFile(project, filepath, ref string) (string, error)
+	GetRepoFile(project, filepath, ref string) (*RepoFile, error)
 	UpdateFile(project, filepath string, req RepoFileRequest) error
+	CommitFiles(project string, req CommitRequest) (*Commit, error)
 	NewBranch(project, branchName, ref string) error
+	GetBranch(project, branchName string) (*Branch, error)
+	DeleteBranch(project, branchName string) error
+	// GetCommit returns the commit of the ref, which is a branch, a tag or a commit SHA.
+	GetCommit(project, ref string) (*Commit, error)
 	ListCommits(project, ref string, since, until *time.Time) ([]*Commit, error)
+	// WalkCommits calls fn with the commits of the ref page by page, the newest first, until fn returns false.
+	WalkCommits(project, ref string, since, until *time.Time, opts ListOptions, fn func(commits []*Commit, page Page) bool) error
 }
 
 type ProjectClient interface {
 	GetProject(project string) (Project, error)
+	ListProtectedTags(project string) ([]ProtectedTag, error)
+	ListProtectedBranches(project string) ([]ProtectedBranch, error)
+}
+
+type UserClient interface {
+	GetVersion() (Version, error)
+	CurrentUser() (User, error)
+	GetCurrentToken() (PersonalAccessToken, error)
 }
 
 type Config interface {
@@ -74,11 +110,52 @@ type Config interface {
 	GetAPIBase() string
 }
 
+const (
+	// AuthBearer sends the token in the `Authorization: Bearer` header, it is the default.
+	AuthBearer = "bearer"
+	// AuthOAuth is an alias of AuthBearer for OAuth2 tokens.
+	AuthOAuth = "oauth"
+	// AuthPrivateToken sends personal, project or group access tokens in the `PRIVATE-TOKEN` header.
+	AuthPrivateToken = "private-token"
+	// AuthJobToken sends the CI job token in the `JOB-TOKEN` header.
+	AuthJobToken = "job-token"
+)
+
+// AuthConfig is implemented by configs which choose how the token is sent.
+type AuthConfig interface {
+	GetAuthType() string
+}
+
+// ValidateAuthType returns an error if the auth type is unknown, empty is the default type.
+func ValidateAuthType(authType string) error {
+	switch authType {
+	case "", AuthBearer, AuthOAuth, AuthPrivateToken, AuthJobToken:
+		return nil
+	}
+	return fmt.Errorf("unknown auth type %q, should be one of %s, %s, %s and %s",
+		authType, AuthBearer, AuthOAuth, AuthPrivateToken, AuthJobToken)
+}
+
+// RetryConfig is implemented by configs which change the initial delay before retrying failed requests.
+type RetryConfig interface {
+	GetRetryDelay() time.Duration
+}
+
+// RequestConfig is implemented by configs which limit the retries and the time of requests, e.g. for quick checks.
+type RequestConfig interface {
+	// GetMaxRetries returns how many times a failed request is retried after the first attempt.
+	GetMaxRetries() int
+	// GetTimeout returns the time limit of a request including reading the response, 0 for no limit.
+	GetTimeout() time.Duration
+}
+
 type Client interface {
 	MergeRequestClient
 	TagClient
+	PackageClient
 	RepoClient
 	ProjectClient
+	UserClient
 }
 
 type client struct {
@@ -94,18 +171,36 @@ type delegate struct {
 	maxSleepTime time.Duration
 	getAPIBase   func() string
 	getToken     func() string
+	getAuthType  func() string
 	dry          bool
+	// pageWorkers is the number of pages requested at the same time.
+	pageWorkers int
+	rateLimit   rateLimit
+	// releases is detected once, see legacyReleases
+	releases releasesSupport
 }
 
-func (c *client) authHeader() string {
+// authHeader returns the header name and value of the token.
+func (c *client) authHeader() (string, string) {
 	if c.getToken == nil {
-		return ""
+		return "", ""
 	}
 	token := c.getToken()
 	if len(token) == 0 {
-		return ""
+		return "", ""
+	}
+	authType := ""
+	if c.getAuthType != nil {
+		authType = c.getAuthType()
+	}
+	switch authType {
+	case AuthPrivateToken:
+		return "PRIVATE-TOKEN", token
+	case AuthJobToken:
+		return "JOB-TOKEN", token
+	default:
+		return "Authorization", fmt.Sprintf("Bearer %s", token)
 	}
-	return fmt.Sprintf("Bearer %s", token)
 }
 
 func (c *client) request(r *request, ret interface{}) (int, error) {
@@ -122,7 +217,8 @@ func (c *client) request(r *request, ret interface{}) (int, error) {
 }
 
 func (c *client) requestRaw(r *request) (int, []byte, error) {
-	if c.dry && r.method != http.MethodGet {
+	// GraphQL queries are POST requests which do not change anything
+	if c.dry && r.method != http.MethodGet && r.path != graphQLPath {
 		return r.exitCodes[0], nil, nil
 	}
 	resp, err := c.requestRetry(r.method, r.path, r.requestBody)
@@ -132,7 +228,7 @@ func (c *client) requestRaw(r *request) (int, []byte, error) {
 	defer utils.CloseSilently(resp.Body)
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return 0, nil, nil
+		return 0, nil, err
 	}
 	var okCode bool
 	for _, code := range r.exitCodes {
@@ -142,9 +238,7 @@ func (c *client) requestRaw(r *request) (int, []byte, error) {
 		}
 	}
 	if !okCode {
-		err = requestError{
-			ErrorString: fmt.Sprintf("status code %d not one of %v, body: %s", resp.StatusCode, r.exitCodes, string(b)),
-		}
+		err = newAPIError(r.method, r.path, resp.StatusCode, b)
 	}
 	return resp.StatusCode, b, err
 }
@@ -157,12 +251,22 @@ func (c *client) requestRetry(method, path string, body interface{}) (*http.Resp
 		if retries > 0 && resp != nil {
 			_ = resp.Body.Close()
 		}
-		base := c.getAPIBase()
-		resp, err = c.doRequest(method, base+path, body)
+		c.waitRateLimit()
+		resp, err = c.doRequest(method, c.endpoint(path), body)
 		if err == nil {
-			if resp.StatusCode < 500 {
+			c.updateRateLimit(resp, backoff)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				c.logger.Debug("Retrying 429 after the rate limit resets")
+				backoff *= 2
+			} else if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+				b, _ := ioutil.ReadAll(resp.Body)
+				_ = resp.Body.Close()
+				err = &authError{newAPIError(method, path, resp.StatusCode, b)}
+				c.logger.WithError(err).Debug("Stopping retry due to authError")
+				return nil, err
+			} else if resp.StatusCode < 500 {
 				break
-			} else {
+			} else if retries < c.maxRetries-1 {
 				c.logger.WithField("backoff", backoff.String()).Debug("Retrying 5XX")
 				c.time.Sleep(backoff)
 				backoff *= 2
@@ -170,11 +274,13 @@ func (c *client) requestRetry(method, path string, body interface{}) (*http.Resp
 		} else if errors.Is(err, &authError{}) {
 			c.logger.WithError(err).Error("Stopping retry dur to authError")
 			return resp, err
-		} else {
+		} else if cfgErr := (*configError)(nil); errors.As(err, &cfgErr) {
+			return nil, cfgErr.error
+		} else if retries < c.maxRetries-1 {
 			c.logger.WithFields(logrus.Fields{
 				"err":      err,
 				"backoff":  backoff.String(),
-				"endpoint": base,
+				"endpoint": c.getAPIBase(),
 			}).Debug("Retrying request due to connection problem")
 			c.time.Sleep(backoff)
 			backoff *= 2
@@ -186,7 +292,11 @@ func (c *client) requestRetry(method, path string, body interface{}) (*http.Resp
 func (c *client) doRequest(method, path string, body interface{}) (*http.Response, error) {
 	var buf io.Reader
 	headers := make(map[string]string)
-	if body != nil {
+	if raw, ok := body.([]byte); ok {
+		// a new reader for each retry
+		buf = bytes.NewReader(raw)
+		headers["Content-Type"] = "application/octet-stream"
+	} else if body != nil {
 		b, err := json.Marshal(body)
 		if err != nil {
 			return nil, err
@@ -200,15 +310,14 @@ func (c *client) doRequest(method, path string, body interface{}) (*http.Respons
 		return nil, err
 	}
 
-	if header := c.authHeader(); len(header) > 0 {
-		req.Header.Set("Authorization", header)
+	if name, value := c.authHeader(); len(value) > 0 {
+		req.Header.Set(name, value)
 	}
 
 	for k, v := range headers {
 		req.Header.Set(k, v)
 	}
 
-	req.Close = true
 	return c.client.Do(req)
 }
 
@@ -223,14 +332,6 @@ type request struct {
 	exitCodes   []int
 }
 
-type requestError struct {
-	ErrorString string
-}
-
-func (r requestError) Error() string {
-	return r.ErrorString
-}
-
 func (c *client) log(methodName string, args ...interface{}) (logDuration func()) {
 	if c.logger == nil {
 		return func() {}
@@ -293,6 +394,23 @@ func (c *client) GetMergeRequest(project string, iid int) (*MergeRequest, error)
 	return mr, nil
 }
 
+func (c *client) GetMergeRequestChanges(project string, iid int) ([]MergeRequestChange, error) {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d/changes", url.PathEscape(project), iid)
+
+	mr := struct {
+		Changes []MergeRequestChange `json:"changes"`
+	}{}
+	_, err := c.request(&request{
+		method:    http.MethodGet,
+		path:      path,
+		exitCodes: []int{200},
+	}, &mr)
+	if err != nil {
+		return nil, err
+	}
+	return mr.Changes, nil
+}
+
 func (c *client) CreateMergeRequest(project string, req MergeRequestRequest) (*MergeRequest, error) {
 	path := fmt.Sprintf("/projects/%s/merge_requests", url.PathEscape(project))
 	mr := MergeRequest{}
@@ -305,6 +423,47 @@ func (c *client) CreateMergeRequest(project string, req MergeRequestRequest) (*M
 	return &mr, err
 }
 
+func (c *client) UpdateMergeRequest(project string, iid int, req MergeRequestUpdate) (*MergeRequest, error) {
+	path := fmt.Sprintf("/projects/%s/merge_requests/%d", url.PathEscape(project), iid)
+	mr := MergeRequest{}
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        path,
+		requestBody: &req,
+		exitCodes:   []int{200},
+	}, &mr)
+	return &mr, err
+}
+
+func (c *client) FindMergeRequests(project string, query MergeRequestQuery) ([]MergeRequest, error) {
+	c.log("FindMergeRequests", project, query)
+	var mrs []MergeRequest
+
+	path := fmt.Sprintf("/projects/%s/merge_requests", url.PathEscape(project))
+	values := url.Values{
+		"per_page": []string{"100"},
+	}
+	for k, v := range obj2values(query) {
+		if v[0] != "" {
+			values[k] = v
+		}
+	}
+	err := c.readPaginatedResultsWithValues(
+		path,
+		values,
+		func() interface{} {
+			return &[]MergeRequest{}
+		},
+		func(obj interface{}) {
+			mrs = append(mrs, *(obj.(*[]MergeRequest))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return mrs, nil
+}
+
 func (c *client) AcceptMR(project string, mrid int) (*MergeRequest, error) {
 	path := fmt.Sprintf("/projects/%s/merge_requests/%d/merge",
 		url.PathEscape(project),
@@ -324,8 +483,9 @@ func (c *client) ListTags(project string) ([]Tag, error) {
 	var tags []Tag
 
 	path := fmt.Sprintf("/projects/%s/repository/tags", url.PathEscape(project))
-	err := c.readPaginateResults(
+	err := c.readAllPages(
 		path,
+		nil,
 		func() interface{} {
 			return &[]Tag{}
 		},
@@ -336,7 +496,23 @@ func (c *client) ListTags(project string) ([]Tag, error) {
 	if err != nil {
 		return nil, err
 	}
-	return tags, err
+	return tags, nil
+}
+
+func (c *client) WalkTags(project string, opts ListOptions, fn func(tags []Tag, page Page) bool) error {
+	c.log("WalkTags", project)
+	path := fmt.Sprintf("/projects/%s/repository/tags", url.PathEscape(project))
+	return c.readPages(
+		path,
+		nil,
+		opts,
+		func() interface{} {
+			return &[]Tag{}
+		},
+		func(obj interface{}, page Page) bool {
+			return fn(*(obj.(*[]Tag)), page)
+		},
+	)
 }
 
 func obj2values(obj interface{}) url.Values {
@@ -395,52 +571,49 @@ func (c *client) GetTag(project, tag string) (Tag, error) {
 	return t, err
 }
 
-func (c *client) UpsertRelease(project string, tag, desc string) error {
-	method := http.MethodPost // Create
-	if t, err := c.GetTag(project, tag); err == nil && t.Release != nil {
-		method = http.MethodPut
-	}
-
-	path := fmt.Sprintf(
-		"/projects/%s/repository/tags/%s/release",
-		url.PathEscape(project),
-		url.PathEscape(tag),
-	)
-
-	values := url.Values{
-		"description": []string{desc},
+func (c *client) GetFile(project, filepath, ref string) (string, error) {
+	file, err := c.GetRepoFile(project, filepath, ref)
+	if err != nil {
+		return "", err
 	}
-
-	_, err := c.request(&request{
-		method:    method,
-		path:      path + "?" + values.Encode(),
-		exitCodes: []int{200, 201},
-	}, nil)
-	return err
+	return file.Content, nil
 }
 
-func (c *client) GetFile(project, filepath, ref string) (string, error) {
+// GetRepoFile returns the file with decoded content, ErrFileNotFound is returned if the file does not exist.
+func (c *client) GetRepoFile(project, filepath, ref string) (*RepoFile, error) {
 	path := fmt.Sprintf(
 		"/projects/%s/repository/files/%s?ref=%s",
 		url.PathEscape(project),
 		url.PathEscape(filepath),
-		ref,
+		url.QueryEscape(ref),
 	)
-	file := struct {
-		Content string `json:"content"`
-	}{}
-	_, err := c.request(&request{
+	code, b, err := c.requestRaw(&request{
 		method:      http.MethodGet,
 		path:        path,
 		requestBody: nil,
-		exitCodes:   []int{200},
-	}, &file)
+		exitCodes:   []int{200, 404},
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if code == http.StatusNotFound {
+		// a missing project or ref is 404 as well
+		if strings.Contains(string(b), "File Not Found") {
+			return nil, ErrFileNotFound
+		}
+		return nil, newAPIError(http.MethodGet, path, code, b)
+	}
+	file := &RepoFile{}
+	if err = json.Unmarshal(b, file); err != nil {
+		return nil, err
 	}
 	content, err := base64.StdEncoding.DecodeString(file.Content)
-	return string(content), err
-
+	if err != nil {
+		return nil, err
+	}
+	file.Content = string(content)
+	file.Encoding = ""
+	return file, nil
 }
 
 func (c *client) UpdateFile(project, filepath string, req RepoFileRequest) error {
@@ -458,6 +631,18 @@ func (c *client) UpdateFile(project, filepath string, req RepoFileRequest) error
 	return err
 }
 
+func (c *client) CommitFiles(project string, req CommitRequest) (*Commit, error) {
+	path := fmt.Sprintf("/projects/%s/repository/commits", url.PathEscape(project))
+	commit := Commit{}
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        path,
+		requestBody: &req,
+		exitCodes:   []int{201},
+	}, &commit)
+	return &commit, err
+}
+
 func (c *client) NewBranch(project, branchName, ref string) error {
 	path := fmt.Sprintf("/projects/%s/repository/branches", url.PathEscape(project))
 	params := url.Values{
@@ -472,8 +657,83 @@ func (c *client) NewBranch(project, branchName, ref string) error {
 	return err
 }
 
+// GetBranch returns the branch, ErrBranchNotFound is returned if the branch does not exist.
+func (c *client) GetBranch(project, branchName string) (*Branch, error) {
+	path := fmt.Sprintf(
+		"/projects/%s/repository/branches/%s",
+		url.PathEscape(project),
+		url.PathEscape(branchName),
+	)
+	code, b, err := c.requestRaw(&request{
+		method:    http.MethodGet,
+		path:      path,
+		exitCodes: []int{200, 404},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if code == http.StatusNotFound {
+		// a missing project is 404 as well
+		if strings.Contains(string(b), "Branch Not Found") {
+			return nil, ErrBranchNotFound
+		}
+		return nil, newAPIError(http.MethodGet, path, code, b)
+	}
+	branch := &Branch{}
+	if err = json.Unmarshal(b, branch); err != nil {
+		return nil, err
+	}
+	return branch, nil
+}
+
+func (c *client) DeleteBranch(project, branchName string) error {
+	path := fmt.Sprintf(
+		"/projects/%s/repository/branches/%s",
+		url.PathEscape(project),
+		url.PathEscape(branchName),
+	)
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      path,
+		exitCodes: []int{204},
+	}, nil)
+	return err
+}
+
+func (c *client) GetCommit(project, ref string) (*Commit, error) {
+	path := fmt.Sprintf("/projects/%s/repository/commits/%s", url.PathEscape(project), url.PathEscape(ref))
+	commit := Commit{}
+	_, err := c.request(&request{
+		method:    http.MethodGet,
+		path:      path,
+		exitCodes: []int{200},
+	}, &commit)
+	if err != nil {
+		return nil, err
+	}
+	return &commit, nil
+}
+
 func (c *client) ListCommits(project, ref string, since, until *time.Time) ([]*Commit, error) {
 	path := fmt.Sprintf("/projects/%s/repository/commits", url.PathEscape(project))
+	var results []*Commit
+	err := c.readAllPages(
+		path,
+		commitValues(ref, since, until),
+		func() interface{} {
+			return &[]*Commit{}
+		},
+		func(obj interface{}) {
+			results = append(results, *(obj.(*[]*Commit))...)
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func commitValues(ref string, since, until *time.Time) url.Values {
 	values := url.Values{}
 	if ref != "" {
 		values.Set("ref_name", ref)
@@ -484,22 +744,24 @@ func (c *client) ListCommits(project, ref string, since, until *time.Time) ([]*C
 	if until != nil {
 		values.Set("until", until.Format(datetimeFormat))
 	}
+	return values
+}
 
-	var results []*Commit
-	err := c.readPaginatedResultsWithValues(
+func (c *client) WalkCommits(project, ref string, since, until *time.Time, opts ListOptions,
+	fn func(commits []*Commit, page Page) bool,
+) error {
+	path := fmt.Sprintf("/projects/%s/repository/commits", url.PathEscape(project))
+	return c.readPages(
 		path,
-		values,
+		commitValues(ref, since, until),
+		opts,
 		func() interface{} {
 			return &[]*Commit{}
 		},
-		func(obj interface{}) {
-			results = append(results, *(obj.(*[]*Commit))...)
+		func(obj interface{}, page Page) bool {
+			return fn(*(obj.(*[]*Commit)), page)
 		},
 	)
-	if err != nil {
-		return nil, err
-	}
-	return results, nil
 }
 
 func (c *client) GetProject(project string) (pro Project, err error) {
@@ -512,57 +774,99 @@ func (c *client) GetProject(project string) (pro Project, err error) {
 	return
 }
 
-func (c *client) readPaginateResults(path string, newObj func() interface{}, accumulate func(interface{})) error {
-	values := url.Values{
-		"per_page": []string{"100"},
-	}
-	return c.readPaginatedResultsWithValues(path, values, newObj, accumulate)
+func (c *client) ListProtectedTags(project string) ([]ProtectedTag, error) {
+	path := fmt.Sprintf("/projects/%s/protected_tags", url.PathEscape(project))
+	var tags []ProtectedTag
+	err := c.readPaginateResults(
+		path,
+		func() interface{} {
+			return &[]ProtectedTag{}
+		},
+		func(obj interface{}) {
+			tags = append(tags, *(obj.(*[]ProtectedTag))...)
+		},
+	)
+	return tags, err
 }
 
-func (c *client) readPaginatedResultsWithValues(path string, values url.Values, newObj func() interface{}, accumulate func(interface{})) error {
-	pagedPath := path
-	if len(values) > 0 {
-		pagedPath += "?" + values.Encode()
-	}
-	for {
-		resp, err := c.requestRetry(http.MethodGet, pagedPath, nil)
-		if err != nil {
-			return err
-		}
-		defer utils.CloseSilently(resp.Body)
-		if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			return fmt.Errorf("return code not 2XX: %s", resp.Status)
-		}
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return err
-		}
+func (c *client) ListProtectedBranches(project string) ([]ProtectedBranch, error) {
+	path := fmt.Sprintf("/projects/%s/protected_branches", url.PathEscape(project))
+	var branches []ProtectedBranch
+	err := c.readPaginateResults(
+		path,
+		func() interface{} {
+			return &[]ProtectedBranch{}
+		},
+		func(obj interface{}) {
+			branches = append(branches, *(obj.(*[]ProtectedBranch))...)
+		},
+	)
+	return branches, err
+}
 
-		obj := newObj()
-		if err = json.Unmarshal(b, obj); err != nil {
-			return err
-		}
+func (c *client) GetVersion() (v Version, err error) {
+	_, err = c.request(&request{
+		method:    http.MethodGet,
+		path:      "/version",
+		exitCodes: []int{200},
+	}, &v)
+	return
+}
 
-		accumulate(obj)
+func (c *client) CurrentUser() (u User, err error) {
+	_, err = c.request(&request{
+		method:    http.MethodGet,
+		path:      "/user",
+		exitCodes: []int{200},
+	}, &u)
+	return
+}
 
-		link := parseLinks(resp.Header.Get("Link"))["next"]
-		if link == "" {
-			break
-		}
+// GetCurrentToken returns the personal, project or group access token in use.
+func (c *client) GetCurrentToken() (t PersonalAccessToken, err error) {
+	_, err = c.request(&request{
+		method:    http.MethodGet,
+		path:      "/personal_access_tokens/self",
+		exitCodes: []int{200},
+	}, &t)
+	return
+}
 
-		prefix := strings.TrimSuffix(resp.Request.URL.RequestURI(), pagedPath)
+func (c *client) readPaginateResults(path string, newObj func() interface{}, accumulate func(interface{})) error {
+	return c.readPaginatedResultsWithValues(path, nil, newObj, accumulate)
+}
 
-		u, err := url.Parse(link)
-		if err != nil {
-			return fmt.Errorf("failed to parse 'next' link: %v", err)
-		}
-		pagedPath = strings.TrimPrefix(u.RequestURI(), prefix)
-	}
-	return nil
+func (c *client) readPaginatedResultsWithValues(path string, values url.Values, newObj func() interface{}, accumulate func(interface{})) error {
+	return c.readPages(path, values, ListOptions{}, newObj, func(obj interface{}, _ Page) bool {
+		accumulate(obj)
+		return true
+	})
 }
 
 func NewClient(logger *logrus.Entry, configProvider Config) Client {
-	httpClient := &http.Client{Timeout: maxRequestTime}
+	transportConfig, _ := configProvider.(TransportConfig)
+	requestConfig, _ := configProvider.(RequestConfig)
+	var httpClient httpClient = &lazyHTTPClient{build: func() (*http.Client, error) {
+		client, err := newHTTPClient(logger, transportConfig)
+		if err == nil && requestConfig != nil {
+			client.Timeout = requestConfig.GetTimeout()
+		}
+		return client, err
+	}}
+	if cacheConfig, ok := configProvider.(CacheConfig); ok {
+		httpClient = &cacheClient{
+			client:      httpClient,
+			getCacheDir: cacheConfig.GetCacheDir,
+			getToken:    configProvider.GetToken,
+		}
+	}
+	if cassetteConfig, ok := configProvider.(CassetteConfig); ok {
+		httpClient = &cassetteClient{
+			client:      httpClient,
+			getCassette: cassetteConfig.GetCassette,
+			getToken:    configProvider.GetToken,
+		}
+	}
 	c := &client{
 		logger: logger,
 		delegate: &delegate{
@@ -574,8 +878,18 @@ func NewClient(logger *logrus.Entry, configProvider Config) Client {
 			maxRetries:   defaultMaxRetries,
 			initialDelay: defaultMaxInitialDelay,
 			maxSleepTime: defaultMaxSleepTime,
+			pageWorkers:  defaultPageWorkers,
 		},
 	}
+	if authConfig, ok := configProvider.(AuthConfig); ok {
+		c.getAuthType = authConfig.GetAuthType
+	}
+	if retryConfig, ok := configProvider.(RetryConfig); ok {
+		c.initialDelay = retryConfig.GetRetryDelay()
+	}
+	if requestConfig != nil {
+		c.maxRetries = requestConfig.GetMaxRetries() + 1
+	}
 
 	return c
 }
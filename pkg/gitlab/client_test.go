@@ -0,0 +1,248 @@
+package gitlab_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestListTagsPagination(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	for _, name := range []string{"v1.0.0", "v1.1.0", "v1.2.0", "v2.0.0", "v2.1.0"} {
+		p.Commit("master", "feat: "+name, nil)
+		p.Tag(name, "master")
+	}
+	s.MaxPerPage = 2
+
+	tags, err := s.Client().ListTags("group/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if got, want := strings.Join(names, ","), "v2.1.0,v2.0.0,v1.2.0,v1.1.0,v1.0.0"; got != want {
+		t.Errorf("got tags %s, want %s", got, want)
+	}
+	if got := len(s.Requests()); got != 3 {
+		t.Errorf("got %d requests, want 3 pages: %v", got, s.Requests())
+	}
+}
+
+func TestListCommits(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	first := p.Commit("master", "first", nil)
+	p.Commit("feature", "on feature", nil)
+	last := p.Commit("master", "last", nil)
+
+	client := s.Client()
+	commits, err := client.ListCommits("group/app", "master", &first.CreatedAt, &last.CreatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || commits[0].ID != last.ID || commits[1].ID != first.ID {
+		t.Errorf("got unexpected commits %+v", commits)
+	}
+}
+
+func TestRetryServerErrors(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	s.Fail(http.MethodGet, "/projects/group/app", http.StatusBadGateway, 2)
+
+	project, err := s.Client().GetProject("group/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if project.PathWithNamespace != "group/app" {
+		t.Errorf("got project %s", project.PathWithNamespace)
+	}
+	if got := len(s.Requests()); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.Token = "secret"
+	s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	client := s.Client()
+
+	if _, err := client.GetRepoFile("group/app", "CHANGELOG.md", "master"); err != gitlab.ErrFileNotFound {
+		t.Errorf("got %v, want ErrFileNotFound", err)
+	}
+	if _, err := client.GetBranch("group/app", "missing"); err != gitlab.ErrBranchNotFound {
+		t.Errorf("got %v, want ErrBranchNotFound", err)
+	}
+	_, err := client.GetProject("group/missing")
+	var apiErr *gitlab.APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "404 Project Not Found" || !gitlab.IsNotFound(err) {
+		t.Errorf("got %v, want 404 Project Not Found", err)
+	}
+
+	s.ResetRequests()
+	_, err = gitlab.NewClient(logrus.NewEntry(logrus.New()), &gitlabtest.Config{APIBase: s.APIBase(), Token: "wrong"}).GetProject("group/app")
+	if !gitlab.IsUnauthorized(err) {
+		t.Errorf("got %v, want 401", err)
+	}
+	if got := len(s.Requests()); got != 1 {
+		t.Errorf("got %d requests, unauthorized requests should not be retried", got)
+	}
+}
+
+func TestCommitAndMergeRequest(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Commit("master", "add changelog", map[string]string{"CHANGELOG.md": "# Changelog\n"})
+	client := s.Client()
+
+	file, err := client.GetRepoFile("group/app", "CHANGELOG.md", "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CommitFiles("group/app", gitlab.CommitRequest{
+		Branch:        "changelog-v1.0.0",
+		StartBranch:   "master",
+		CommitMessage: "docs(changelog): v1.0.0",
+		Actions: []gitlab.CommitAction{{
+			Action:       gitlab.CommitActionUpdate,
+			FilePath:     "CHANGELOG.md",
+			Content:      "# Changelog\n\n# v1.0.0\n",
+			LastCommitID: file.LastCommitID,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr, err := client.CreateMergeRequest("group/app", gitlab.MergeRequestRequest{
+		SourceBranch: "changelog-v1.0.0",
+		TargetBranch: "master",
+		Title:        "docs(changelog): v1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mrs, err := client.FindMergeRequests("group/app", gitlab.MergeRequestQuery{State: "opened", SourceBranch: "changelog-v1.0.0"})
+	if err != nil || len(mrs) != 1 || mrs[0].IID != mr.IID {
+		t.Fatalf("got %v %v, want the created merge request", mrs, err)
+	}
+	if _, err = client.AcceptMR("group/app", mr.IID); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := p.File("master", "CHANGELOG.md"); content != "# Changelog\n\n# v1.0.0\n" {
+		t.Errorf("got changelog %q after merge", content)
+	}
+
+	head := p.Commit("master", "chore: after merge", nil)
+	// a stale branch is reset onto the ref by a forced commit
+	_, err = client.CommitFiles("group/app", gitlab.CommitRequest{
+		Branch:        "changelog-v1.0.0",
+		StartSHA:      head.ID,
+		Force:         true,
+		CommitMessage: "docs(changelog): v1.0.0 again",
+		Actions:       []gitlab.CommitAction{{Action: gitlab.CommitActionCreate, FilePath: "NOTES.md", Content: "notes"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := client.GetCommit("group/app", "changelog-v1.0.0")
+	if err != nil || commit.Title != "docs(changelog): v1.0.0 again" {
+		t.Fatalf("got %v %v, want the forced commit", commit, err)
+	}
+}
+
+func TestWalkTags(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	for i := 0; i < 7; i++ {
+		p.Commit("master", "fix: something", nil)
+		p.Tag(fmt.Sprintf("v1.0.%d", i), "master")
+	}
+	client := s.Client()
+
+	testcases := []struct {
+		name     string
+		opts     gitlab.ListOptions
+		stopAt   string
+		expected int
+		requests int
+	}{
+		{"all pages", gitlab.ListOptions{PerPage: 3}, "", 7, 3},
+		{"stop early", gitlab.ListOptions{PerPage: 3}, "v1.0.3", 4, 2},
+		{"max items", gitlab.ListOptions{PerPage: 3, MaxItems: 4}, "", 4, 2},
+		{"keyset", gitlab.ListOptions{PerPage: 2, Keyset: true}, "", 7, 4},
+	}
+	for _, tc := range testcases {
+		s.ResetRequests()
+		var names []string
+		var pages []gitlab.Page
+		err := client.WalkTags("group/app", tc.opts, func(tags []gitlab.Tag, page gitlab.Page) bool {
+			pages = append(pages, page)
+			for _, tag := range tags {
+				names = append(names, tag.Name)
+				if tag.Name == tc.stopAt {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if len(names) != tc.expected || names[0] != "v1.0.6" {
+			t.Errorf("%s: got tags %v", tc.name, names)
+		}
+		if got := len(s.Requests()); got != tc.requests {
+			t.Errorf("%s: got %d requests, want %d", tc.name, got, tc.requests)
+		}
+		if !tc.opts.Keyset && (pages[0].TotalPages != 3 || pages[0].Total != 7 || pages[len(pages)-1].Number != len(pages)) {
+			t.Errorf("%s: got pages %+v", tc.name, pages)
+		}
+	}
+}
+
+func TestListTagsConcurrently(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	var expected []string
+	for i := 0; i < 9; i++ {
+		p.Commit("master", "fix: something", nil)
+		name := fmt.Sprintf("v1.0.%d", i)
+		p.Tag(name, "master")
+		expected = append([]string{name}, expected...)
+	}
+	s.MaxPerPage = 2
+	s.Fail(http.MethodGet, "/projects/group/app/repository/tags", http.StatusTooManyRequests, 2)
+
+	tags, err := s.Client().ListTags("group/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	if got, want := strings.Join(names, ","), strings.Join(expected, ","); got != want {
+		t.Errorf("got tags %s, want %s", got, want)
+	}
+	if got := len(s.Requests()); got != 7 {
+		t.Errorf("got %d requests, want 5 pages and 2 rate limited", got)
+	}
+}
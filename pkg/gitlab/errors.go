@@ -1,5 +1,79 @@
 package gitlab
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrFileNotFound is returned when the file does not exist in the repository.
+var ErrFileNotFound = errors.New("file not found")
+
+// ErrBranchNotFound is returned when the branch does not exist.
+var ErrBranchNotFound = errors.New("branch not found")
+
+// APIError is returned when GitLab responds with an unexpected status code.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	// Message is the `message` field of the response, e.g. `404 Project Not Found`.
+	Message string
+	// ErrorMessage is the `error` field of the response, e.g. `insufficient_scope`.
+	ErrorMessage string
+	// ErrorDescription is the `error_description` field of OAuth errors.
+	ErrorDescription string
+	Body             string
+}
+
+func newAPIError(method, path string, statusCode int, body []byte) *APIError {
+	e := &APIError{
+		StatusCode: statusCode,
+		Method:     method,
+		Path:       path,
+		Body:       string(body),
+	}
+	fields := struct {
+		Message          json.RawMessage `json:"message"`
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}{}
+	if err := json.Unmarshal(body, &fields); err == nil {
+		e.Message = rawMessage(fields.Message)
+		e.ErrorMessage = rawMessage(fields.Error)
+		e.ErrorDescription = fields.ErrorDescription
+	}
+	return e
+}
+
+// rawMessage returns the string, or the json of objects like `{"base": ["..."]}`.
+func rawMessage(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func (e *APIError) Error() string {
+	var details []string
+	for _, d := range []string{e.Message, e.ErrorMessage, e.ErrorDescription} {
+		if d != "" {
+			details = append(details, d)
+		}
+	}
+	detail := strings.Join(details, ": ")
+	if detail == "" {
+		detail = e.Body
+	}
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode), detail)
+}
+
 type authError struct {
 	error
 }
@@ -8,3 +82,57 @@ func (*authError) Is(target error) bool {
 	_, ok := target.(*authError)
 	return ok
 }
+
+func (e *authError) Unwrap() error {
+	return e.error
+}
+
+// StatusCode returns the status code of the API error, 0 if err is not an API error.
+func StatusCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrFileNotFound) || errors.Is(err, ErrBranchNotFound) || StatusCode(err) == http.StatusNotFound
+}
+
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+// Permissions required by actions, they are passed to DescribeError. walle only calls the API, the
+// read_repository and write_repository scopes grant Git over HTTP and do not authorize these actions.
+const (
+	PermissionRead    = "the token needs the api scope (read_api for reads only) and at least the Reporter role"
+	PermissionPush    = "the token needs the api scope and at least the Developer role, and the branch must not be protected"
+	PermissionWrite   = "the token needs the api scope and at least the Developer role"
+	PermissionMerge   = "the token needs the api scope and the permission to merge into the target branch"
+	PermissionRelease = "the token needs the api scope and at least the Developer role, creating protected tags needs the permission of the protected tag"
+)
+
+// DescribeError explains errors caused by the token, permission describes what the action requires.
+func DescribeError(err error, action, permission string) error {
+	switch {
+	case err == nil:
+		return nil
+	case IsUnauthorized(err):
+		return fmt.Errorf("failed to %s, the token is invalid or expired, check --token, --auth-type or WALLE_GITLAB_TOKEN: %w", action, err)
+	case IsForbidden(err):
+		return fmt.Errorf("failed to %s, permission denied, %s: %w", action, permission, err)
+	case StatusCode(err) == http.StatusNotFound:
+		return fmt.Errorf("failed to %s, not found, check the project exists and the token can access it: %w", action, err)
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package gitlabtest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type graphQLRequest struct {
+	Query     string `json:"query"`
+	Variables struct {
+		FullPath    string   `json:"fullPath"`
+		IIDs        []string `json:"iids"`
+		WithChanges bool     `json:"withChanges"`
+	} `json:"variables"`
+}
+
+type graphQLLabel struct {
+	Title string `json:"title"`
+}
+
+type graphQLMergeRequest struct {
+	IID            string     `json:"iid"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	State          string     `json:"state"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	MergedAt       *time.Time `json:"mergedAt"`
+	WebURL         string     `json:"webUrl"`
+	SourceBranch   string     `json:"sourceBranch"`
+	TargetBranch   string     `json:"targetBranch"`
+	MergeCommitSHA string     `json:"mergeCommitSha"`
+	Labels         struct {
+		Nodes []graphQLLabel `json:"nodes"`
+	} `json:"labels"`
+	Author struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Username  string `json:"username"`
+		AvatarURL string `json:"avatarUrl"`
+		WebURL    string `json:"webUrl"`
+	} `json:"author"`
+	ClosingIssues struct {
+		Nodes []graphQLIssue `json:"nodes"`
+	} `json:"closingIssues"`
+	DiffStats []map[string]string `json:"diffStats,omitempty"`
+}
+
+type graphQLIssue struct {
+	IID    string `json:"iid"`
+	Title  string `json:"title"`
+	WebURL string `json:"webUrl"`
+}
+
+// serveGraphQL answers the query of merge requests by IIDs, which is the only query walle sends.
+// Like GitLab, errors are returned with 200 OK in the `errors` field.
+func (s *Server) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	req := graphQLRequest{}
+	if !decode(w, r, &req) {
+		return
+	}
+	if !strings.Contains(req.Query, "mergeRequests(") {
+		writeGraphQLError(w, "query is not supported by gitlabtest")
+		return
+	}
+	p := s.project(req.Variables.FullPath)
+	if p == nil {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"project": nil}})
+		return
+	}
+
+	nodes := []graphQLMergeRequest{}
+	for _, iid := range req.Variables.IIDs {
+		n, err := strconv.Atoi(iid)
+		if err != nil {
+			writeGraphQLError(w, fmt.Sprintf("invalid iid %q", iid))
+			return
+		}
+		if n < 1 || n > len(p.mrs) {
+			continue
+		}
+		m := p.mrs[n-1]
+		node := graphQLMergeRequest{
+			IID:            iid,
+			Title:          m.Title,
+			Description:    m.Description,
+			State:          m.State,
+			CreatedAt:      m.CreatedAt,
+			UpdatedAt:      m.UpdatedAt,
+			WebURL:         m.WebURL,
+			SourceBranch:   m.SourceBranch,
+			TargetBranch:   m.TargetBranch,
+			MergeCommitSHA: m.MergeCommitSHA,
+		}
+		if !m.MergedAt.IsZero() {
+			mergedAt := m.MergedAt
+			node.MergedAt = &mergedAt
+		}
+		node.Labels.Nodes = []graphQLLabel{}
+		for _, label := range m.Labels {
+			node.Labels.Nodes = append(node.Labels.Nodes, graphQLLabel{Title: label})
+		}
+		node.Author.ID = fmt.Sprintf("gid://gitlab/User/%d", m.Author.ID)
+		node.Author.Name = m.Author.Name
+		node.Author.Username = m.Author.Username
+		node.Author.AvatarURL = m.Author.AvatarURL
+		node.Author.WebURL = m.Author.WebURL
+		node.ClosingIssues.Nodes = []graphQLIssue{}
+		for _, issue := range m.ClosingIssues {
+			node.ClosingIssues.Nodes = append(node.ClosingIssues.Nodes,
+				graphQLIssue{IID: strconv.Itoa(issue.IID), Title: issue.Title, WebURL: issue.WebURL})
+		}
+		if req.Variables.WithChanges {
+			node.DiffStats = []map[string]string{}
+			for _, change := range m.changes {
+				node.DiffStats = append(node.DiffStats, map[string]string{"path": change.NewPath})
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"data": map[string]interface{}{
+			"project": map[string]interface{}{
+				"mergeRequests": map[string]interface{}{"nodes": nodes},
+			},
+		},
+	})
+}
+
+func writeGraphQLError(w http.ResponseWriter, message string) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+}
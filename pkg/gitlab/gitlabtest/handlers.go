@@ -0,0 +1,659 @@
+package gitlabtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"walle/pkg/gitlab"
+)
+
+// serveHTTP serves the endpoints under /projects/:id, segs are the segments after the project.
+func (p *Project) serveHTTP(w http.ResponseWriter, r *http.Request, segs []string) {
+	route := r.Method
+	if len(segs) > 0 {
+		route += " " + segs[0]
+		if segs[0] == "repository" && len(segs) > 1 {
+			route += "/" + segs[1]
+		}
+	}
+	switch route {
+	case "GET":
+		writeJSON(w, http.StatusOK, p.info)
+	case "GET protected_tags":
+		p.s.paginate(w, r, p.protectedTags)
+	case "GET protected_branches":
+		p.s.paginate(w, r, p.protectedBranches)
+	case "GET repository/tags", "POST repository/tags", "PUT repository/tags":
+		p.serveTags(w, r, segs[2:])
+	case "GET releases", "POST releases", "PUT releases", "DELETE releases":
+		if p.s.before(11, 7) {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		p.serveReleases(w, r, segs[1:])
+	case "GET repository/commits", "POST repository/commits":
+		p.serveCommits(w, r, segs[2:])
+	case "GET repository/files", "PUT repository/files":
+		p.serveFiles(w, r, segs[2:])
+	case "GET repository/branches", "POST repository/branches", "DELETE repository/branches":
+		p.serveBranches(w, r, segs[2:])
+	case "GET merge_requests", "POST merge_requests", "PUT merge_requests":
+		p.serveMergeRequests(w, r, segs)
+	case "GET packages", "PUT packages":
+		p.servePackages(w, r, segs[1:])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func decode(w http.ResponseWriter, r *http.Request, obj interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(obj); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %v", err))
+		return false
+	}
+	return true
+}
+
+func (p *Project) serveTags(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 0:
+		var tags []gitlab.Tag
+		for name := range p.tags {
+			tags = append(tags, *p.tag(name))
+		}
+		// GitLab sorts tags by the commit date, the newest first
+		sort.Slice(tags, func(i, j int) bool {
+			if !tags[i].Commit.CreatedAt.Equal(tags[j].Commit.CreatedAt) {
+				return tags[i].Commit.CreatedAt.After(tags[j].Commit.CreatedAt)
+			}
+			return tags[i].Name > tags[j].Name
+		})
+		p.s.paginate(w, r, tags)
+	case r.Method == http.MethodGet && len(segs) == 1:
+		tag := p.tag(segs[0])
+		if tag == nil {
+			writeError(w, http.StatusNotFound, "404 Tag Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, tag)
+	case r.Method == http.MethodPost && len(segs) == 0:
+		query := r.URL.Query()
+		tag, err := p.createTag(query.Get("tag_name"), query.Get("ref"), query.Get("message"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		// release_description is removed in GitLab 15.0
+		if desc := query.Get("release_description"); desc != "" && p.s.before(15, 0) {
+			p.releases[tag.Name] = &gitlab.Release{TagName: tag.Name, Name: tag.Name, Description: desc, CreatedAt: p.s.now, ReleasedAt: p.s.now}
+		}
+		writeJSON(w, http.StatusCreated, p.tag(tag.Name))
+	case len(segs) == 2 && segs[1] == "release" && (r.Method == http.MethodPost || r.Method == http.MethodPut) && p.s.before(15, 0):
+		// the release endpoint of tags, deprecated in GitLab 11.7 and removed in 15.0
+		if p.tags[segs[0]] == nil {
+			writeError(w, http.StatusNotFound, "404 Tag Not Found")
+			return
+		}
+		_, exists := p.releases[segs[0]]
+		if r.Method == http.MethodPost && exists {
+			writeError(w, http.StatusConflict, "Release already exists")
+			return
+		}
+		if r.Method == http.MethodPut && !exists {
+			writeError(w, http.StatusNotFound, "404 Release Not Found")
+			return
+		}
+		release := p.releases[segs[0]]
+		if release == nil {
+			release = &gitlab.Release{TagName: segs[0], Name: segs[0], CreatedAt: p.s.now, ReleasedAt: p.s.now}
+			p.releases[segs[0]] = release
+		}
+		release.Description = r.URL.Query().Get("description")
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		writeJSON(w, status, release)
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (p *Project) serveReleases(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 0:
+		var releases []gitlab.Release
+		for name := range p.releases {
+			releases = append(releases, *p.releases[name])
+		}
+		sort.Slice(releases, func(i, j int) bool {
+			ti, tj := p.tags[releases[i].TagName], p.tags[releases[j].TagName]
+			if ti != nil && tj != nil && !ti.Commit.CreatedAt.Equal(tj.Commit.CreatedAt) {
+				return ti.Commit.CreatedAt.After(tj.Commit.CreatedAt)
+			}
+			return releases[i].TagName > releases[j].TagName
+		})
+		p.s.paginate(w, r, releases)
+	case r.Method == http.MethodGet && len(segs) == 1:
+		release, ok := p.releases[segs[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, release)
+	case r.Method == http.MethodPost && len(segs) == 0:
+		req := gitlab.ReleaseRequest{}
+		if !decode(w, r, &req) {
+			return
+		}
+		if _, ok := p.releases[req.TagName]; ok {
+			writeError(w, http.StatusConflict, "Release already exists")
+			return
+		}
+		if p.tags[req.TagName] == nil {
+			if req.Ref == "" {
+				writeError(w, http.StatusBadRequest, "Ref is not specified")
+				return
+			}
+			if _, err := p.createTag(req.TagName, req.Ref, req.TagMessage); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		release := &gitlab.Release{TagName: req.TagName, Name: req.TagName, CreatedAt: p.s.now, ReleasedAt: p.s.now}
+		p.updateRelease(release, gitlab.ReleaseUpdate{
+			Name:        req.Name,
+			Description: req.Description,
+			Milestones:  req.Milestones,
+			ReleasedAt:  req.ReleasedAt,
+		})
+		if req.Assets != nil {
+			for _, link := range req.Assets.Links {
+				if !p.addReleaseLink(w, release, link) {
+					return
+				}
+			}
+		}
+		p.releases[req.TagName] = release
+		writeJSON(w, http.StatusCreated, release)
+	case r.Method == http.MethodPut && len(segs) == 1:
+		release, ok := p.releases[segs[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		// like GitLab, a description which is not sent is not changed
+		req := struct {
+			gitlab.ReleaseUpdate
+			Description *string `json:"description"`
+		}{}
+		if !decode(w, r, &req) {
+			return
+		}
+		req.ReleaseUpdate.Description = release.Description
+		if req.Description != nil {
+			req.ReleaseUpdate.Description = *req.Description
+		}
+		p.updateRelease(release, req.ReleaseUpdate)
+		writeJSON(w, http.StatusOK, release)
+	case len(segs) >= 3 && segs[1] == "assets" && segs[2] == "links":
+		release, ok := p.releases[segs[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		p.serveReleaseLinks(w, r, release, segs[3:])
+	case r.Method == http.MethodDelete && len(segs) == 1:
+		release, ok := p.releases[segs[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		delete(p.releases, segs[0])
+		writeJSON(w, http.StatusOK, release)
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+// servePackages serves the files of generic packages, segs are `generic/:name/:version/:file`.
+func (p *Project) servePackages(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) != 4 || segs[0] != "generic" {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	key := strings.Join(segs[1:], "/")
+	switch r.Method {
+	case http.MethodPut:
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		p.packages[key] = content
+		writeJSON(w, http.StatusCreated, map[string]string{"message": "201 Created"})
+	case http.MethodGet:
+		content, ok := p.packages[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Package Not Found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(content)
+	}
+}
+
+// updateRelease sets the description and the non-empty fields else of the request.
+func (p *Project) updateRelease(release *gitlab.Release, req gitlab.ReleaseUpdate) {
+	if req.Name != "" {
+		release.Name = req.Name
+	}
+	release.Description = req.Description
+	if req.ReleasedAt != nil {
+		release.ReleasedAt = *req.ReleasedAt
+	}
+	if req.Milestones != nil {
+		release.Milestones = nil
+		for _, title := range req.Milestones {
+			p.s.lastID++
+			release.Milestones = append(release.Milestones, gitlab.Milestone{ID: p.s.lastID, Title: title})
+		}
+	}
+}
+
+func (p *Project) addReleaseLink(w http.ResponseWriter, release *gitlab.Release, link gitlab.ReleaseLink) bool {
+	if link.Name == "" || link.URL == "" {
+		writeError(w, http.StatusBadRequest, "name and url are required")
+		return false
+	}
+	for _, other := range release.Assets.Links {
+		if other.Name == link.Name || other.URL == link.URL {
+			writeError(w, http.StatusBadRequest, "has already been taken")
+			return false
+		}
+	}
+	if link.LinkType == "" {
+		link.LinkType = gitlab.LinkTypeOther
+	}
+	p.s.lastID++
+	link.ID = p.s.lastID
+	release.Assets.Links = append(release.Assets.Links, link)
+	return true
+}
+
+func (p *Project) serveReleaseLinks(w http.ResponseWriter, r *http.Request, release *gitlab.Release, segs []string) {
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 0:
+		writeJSON(w, http.StatusOK, release.Assets.Links)
+	case r.Method == http.MethodPost && len(segs) == 0:
+		link := gitlab.ReleaseLink{}
+		if !decode(w, r, &link) || !p.addReleaseLink(w, release, link) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, release.Assets.Links[len(release.Assets.Links)-1])
+	case r.Method == http.MethodPut && len(segs) == 1:
+		for i := range release.Assets.Links {
+			link := &release.Assets.Links[i]
+			if strconv.Itoa(link.ID) != segs[0] {
+				continue
+			}
+			req := gitlab.ReleaseLink{}
+			if !decode(w, r, &req) {
+				return
+			}
+			if req.Name != "" {
+				link.Name = req.Name
+			}
+			if req.URL != "" {
+				link.URL = req.URL
+			}
+			if req.LinkType != "" {
+				link.LinkType = req.LinkType
+			}
+			writeJSON(w, http.StatusOK, link)
+			return
+		}
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func parseTime(w http.ResponseWriter, value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid time %s", value))
+		return nil, false
+	}
+	return &t, true
+}
+
+func (p *Project) serveCommits(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 0:
+		query := r.URL.Query()
+		head := p.resolve(query.Get("ref_name"))
+		if head == nil {
+			writeError(w, http.StatusNotFound, "404 Not Found")
+			return
+		}
+		since, ok := parseTime(w, query.Get("since"))
+		if !ok {
+			return
+		}
+		until, ok := parseTime(w, query.Get("until"))
+		if !ok {
+			return
+		}
+		commits := []gitlab.Commit{}
+		for _, c := range history(head) {
+			if since != nil && c.CreatedAt.Before(*since) || until != nil && c.CreatedAt.After(*until) {
+				continue
+			}
+			commits = append(commits, c.Commit)
+		}
+		p.s.paginate(w, r, commits)
+	case r.Method == http.MethodGet && len(segs) == 1:
+		c := p.resolve(segs[0])
+		if c == nil {
+			writeError(w, http.StatusNotFound, "404 Commit Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, c.Commit)
+	case r.Method == http.MethodPost && len(segs) == 0:
+		req := gitlab.CommitRequest{}
+		if !decode(w, r, &req) {
+			return
+		}
+		p.commitFiles(w, req)
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func (p *Project) commitFiles(w http.ResponseWriter, req gitlab.CommitRequest) {
+	b, exists := p.branches[req.Branch]
+	start := p.resolve(req.StartBranch)
+	if req.StartSHA != "" {
+		start = p.commits[req.StartSHA]
+	}
+	var parent *commit
+	switch {
+	case exists && !req.Force:
+		parent = b.head
+	case req.StartBranch != "" || req.StartSHA != "":
+		if start == nil {
+			writeError(w, http.StatusBadRequest, "Invalid start branch or start sha")
+			return
+		}
+		parent = start
+	default:
+		writeError(w, http.StatusBadRequest, "You can only create or edit files when you are on a branch")
+		return
+	}
+
+	changes := map[string]string{}
+	for _, a := range req.Actions {
+		content := a.Content
+		if a.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Content)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid base64 content")
+				return
+			}
+			content = string(decoded)
+		}
+		f, fileExists := parent.files[a.FilePath]
+		if a.LastCommitID != "" && fileExists && f.lastCommitID != a.LastCommitID {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("The file %s has changed since you started editing it", a.FilePath))
+			return
+		}
+		switch a.Action {
+		case gitlab.CommitActionCreate:
+			if fileExists {
+				writeError(w, http.StatusBadRequest, "A file with this name already exists")
+				return
+			}
+			changes[a.FilePath] = content
+		case gitlab.CommitActionUpdate:
+			if !fileExists {
+				writeError(w, http.StatusBadRequest, "A file with this name doesn't exist")
+				return
+			}
+			changes[a.FilePath] = content
+		case gitlab.CommitActionDelete:
+			if !fileExists {
+				writeError(w, http.StatusBadRequest, "A file with this name doesn't exist")
+				return
+			}
+			changes[a.FilePath] = ""
+		case gitlab.CommitActionMove:
+			old, ok := parent.files[a.PreviousPath]
+			if !ok {
+				writeError(w, http.StatusBadRequest, "A file with this name doesn't exist")
+				return
+			}
+			if content == "" {
+				content = old.content
+			}
+			changes[a.PreviousPath] = ""
+			changes[a.FilePath] = content
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown action %s", a.Action))
+			return
+		}
+	}
+
+	c := p.newCommit(parent, req.CommitMessage, changes)
+	p.branches[req.Branch] = &branch{name: req.Branch, head: c}
+	p.commitRequests = append(p.commitRequests, req)
+	writeJSON(w, http.StatusCreated, c.Commit)
+}
+
+func (p *Project) serveFiles(w http.ResponseWriter, r *http.Request, segs []string) {
+	if len(segs) != 1 {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	path := segs[0]
+	switch r.Method {
+	case http.MethodGet:
+		ref := r.URL.Query().Get("ref")
+		c := p.resolve(ref)
+		if c == nil {
+			writeError(w, http.StatusNotFound, "404 Commit Not Found")
+			return
+		}
+		f, ok := c.files[path]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 File Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, gitlab.RepoFile{
+			FileName:     path[strings.LastIndex(path, "/")+1:],
+			FilePath:     path,
+			Ref:          ref,
+			CommitID:     c.ID,
+			LastCommitID: f.lastCommitID,
+			Encoding:     "base64",
+			Content:      base64.StdEncoding.EncodeToString([]byte(f.content)),
+		})
+	case http.MethodPut:
+		req := gitlab.RepoFileRequest{}
+		if !decode(w, r, &req) {
+			return
+		}
+		b, ok := p.branches[req.Branch]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "You can only create or edit files when you are on a branch")
+			return
+		}
+		if _, ok = b.head.files[path]; !ok {
+			writeError(w, http.StatusBadRequest, "A file with this name doesn't exist")
+			return
+		}
+		content := req.Content
+		if req.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(req.Content)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "invalid base64 content")
+				return
+			}
+			content = string(decoded)
+		}
+		b.head = p.newCommit(b.head, req.CommitMessage, map[string]string{path: content})
+		writeJSON(w, http.StatusOK, map[string]string{"file_path": path, "branch": req.Branch})
+	}
+}
+
+func (p *Project) serveBranches(w http.ResponseWriter, r *http.Request, segs []string) {
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 0:
+		var branches []gitlab.Branch
+		for _, name := range sortedKeys(p.branches) {
+			branches = append(branches, p.branchInfo(p.branches[name]))
+		}
+		p.s.paginate(w, r, branches)
+	case r.Method == http.MethodGet && len(segs) == 1:
+		b, ok := p.branches[segs[0]]
+		if !ok {
+			writeError(w, http.StatusNotFound, "404 Branch Not Found")
+			return
+		}
+		writeJSON(w, http.StatusOK, p.branchInfo(b))
+	case r.Method == http.MethodPost && len(segs) == 0:
+		query := r.URL.Query()
+		name := query.Get("branch")
+		if _, ok := p.branches[name]; ok {
+			writeError(w, http.StatusBadRequest, "Branch already exists")
+			return
+		}
+		c := p.resolve(query.Get("ref"))
+		if c == nil {
+			writeError(w, http.StatusBadRequest, "Invalid reference name")
+			return
+		}
+		b := &branch{name: name, head: c}
+		p.branches[name] = b
+		writeJSON(w, http.StatusCreated, p.branchInfo(b))
+	case r.Method == http.MethodDelete && len(segs) == 1:
+		if _, ok := p.branches[segs[0]]; !ok {
+			writeError(w, http.StatusNotFound, "404 Branch Not Found")
+			return
+		}
+		if segs[0] == p.info.DefaultBranch {
+			writeError(w, http.StatusBadRequest, "The default branch of a project cannot be deleted.")
+			return
+		}
+		delete(p.branches, segs[0])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func sortedKeys(branches map[string]*branch) []string {
+	var keys []string
+	for k := range branches {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (p *Project) serveMergeRequests(w http.ResponseWriter, r *http.Request, segs []string) {
+	var m *mergeRequest
+	if len(segs) > 1 {
+		iid, err := strconv.Atoi(segs[1])
+		if err == nil {
+			m = p.mergeRequest(iid)
+		}
+		if m == nil {
+			writeError(w, http.StatusNotFound, "404 Not found")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodGet && len(segs) == 1:
+		query := r.URL.Query()
+		updatedAfter, ok := parseTime(w, query.Get("updated_after"))
+		if !ok {
+			return
+		}
+		mrs := []gitlab.MergeRequest{}
+		// GitLab returns the newest first
+		for i := len(p.mrs) - 1; i >= 0; i-- {
+			mr := p.mrs[i].MergeRequest
+			if state := query.Get("state"); state != "" && state != "all" && state != mr.State ||
+				query.Get("source_branch") != "" && query.Get("source_branch") != mr.SourceBranch ||
+				query.Get("target_branch") != "" && query.Get("target_branch") != mr.TargetBranch ||
+				updatedAfter != nil && mr.UpdatedAt.Before(*updatedAfter) {
+				continue
+			}
+			mrs = append(mrs, mr)
+		}
+		p.s.paginate(w, r, mrs)
+	case r.Method == http.MethodGet && len(segs) == 2:
+		writeJSON(w, http.StatusOK, m.MergeRequest)
+	case r.Method == http.MethodGet && len(segs) == 3 && segs[2] == "changes":
+		writeJSON(w, http.StatusOK, struct {
+			gitlab.MergeRequest
+			Changes []gitlab.MergeRequestChange `json:"changes"`
+		}{m.MergeRequest, m.changes})
+	case r.Method == http.MethodPost && len(segs) == 1:
+		req := gitlab.MergeRequestRequest{}
+		if !decode(w, r, &req) {
+			return
+		}
+		if _, ok := p.branches[req.SourceBranch]; !ok {
+			writeError(w, http.StatusBadRequest, "Source branch does not exist")
+			return
+		}
+		for _, other := range p.mrs {
+			if other.State == "opened" && other.SourceBranch == req.SourceBranch && other.TargetBranch == req.TargetBranch {
+				writeError(w, http.StatusConflict, fmt.Sprintf("Another open merge request already exists for this source branch: !%d", other.IID))
+				return
+			}
+		}
+		m = p.addMergeRequest(gitlab.MergeRequest{
+			Title:        req.Title,
+			Description:  req.Description,
+			SourceBranch: req.SourceBranch,
+			TargetBranch: req.TargetBranch,
+		})
+		writeJSON(w, http.StatusCreated, m.MergeRequest)
+	case r.Method == http.MethodPut && len(segs) == 2:
+		req := gitlab.MergeRequestUpdate{}
+		if !decode(w, r, &req) {
+			return
+		}
+		if req.Title != "" {
+			m.Title = req.Title
+		}
+		if req.Description != "" {
+			m.Description = req.Description
+		}
+		m.UpdatedAt = p.s.now
+		writeJSON(w, http.StatusOK, m.MergeRequest)
+	case r.Method == http.MethodPut && len(segs) == 3 && segs[2] == "merge":
+		if m.State != "opened" {
+			writeError(w, http.StatusMethodNotAllowed, "405 Method Not Allowed")
+			return
+		}
+		p.merge(m, nil)
+		writeJSON(w, http.StatusOK, m.MergeRequest)
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
@@ -0,0 +1,408 @@
+package gitlabtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"walle/pkg/gitlab"
+)
+
+// Project is a repository of the fake server, its methods are safe to call while the server is running.
+type Project struct {
+	s    *Server
+	info gitlab.Project
+
+	commits  map[string]*commit
+	branches map[string]*branch
+	tags     map[string]*gitlab.Tag
+	releases map[string]*gitlab.Release
+	mrs      []*mergeRequest
+	// packages are the files of generic packages by `name/version/file`
+	packages map[string][]byte
+
+	protectedTags     []gitlab.ProtectedTag
+	protectedBranches []gitlab.ProtectedBranch
+	// commitRequests are the requests of the commits API which created commits
+	commitRequests []gitlab.CommitRequest
+}
+
+type commit struct {
+	gitlab.Commit
+	parent *commit
+	files  map[string]*file
+}
+
+type file struct {
+	content      string
+	lastCommitID string
+}
+
+type branch struct {
+	name string
+	head *commit
+}
+
+type mergeRequest struct {
+	gitlab.MergeRequest
+	changes []gitlab.MergeRequestChange
+}
+
+// AddProject adds an empty project with an initial commit on the default branch, `master` if not set.
+func (s *Server) AddProject(info gitlab.Project) *Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	if info.ID == 0 {
+		info.ID = s.lastID
+	}
+	if info.DefaultBranch == "" {
+		info.DefaultBranch = "master"
+	}
+	if info.Name == "" {
+		info.Name = info.PathWithNamespace[strings.LastIndex(info.PathWithNamespace, "/")+1:]
+	}
+	if info.WebURL == "" {
+		info.WebURL = s.URL + "/" + info.PathWithNamespace
+	}
+	if info.Permissions.ProjectAccess == nil && info.Permissions.GroupAccess == nil {
+		info.Permissions.ProjectAccess = &gitlab.Access{AccessLevel: gitlab.MaintainerAccess}
+	}
+	p := &Project{
+		s:        s,
+		info:     info,
+		commits:  map[string]*commit{},
+		branches: map[string]*branch{},
+		tags:     map[string]*gitlab.Tag{},
+		releases: map[string]*gitlab.Release{},
+		packages: map[string][]byte{},
+	}
+	root := p.newCommit(nil, "Initial commit", nil)
+	p.branches[info.DefaultBranch] = &branch{name: info.DefaultBranch, head: root}
+	s.projects = append(s.projects, p)
+	return p
+}
+
+// Info returns the project as returned by the API.
+func (p *Project) Info() gitlab.Project {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	return p.info
+}
+
+// Move moves the project to the path, e.g. by renaming or transferring it. Merge commits made before keep the old path.
+func (p *Project) Move(path string) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	p.info.PathWithNamespace = path
+	p.info.WebURL = p.s.URL + "/" + path
+}
+
+// newCommit creates a commit on top of parent, files are copied from parent and changed by the changes,
+// an empty content deletes the file.
+func (p *Project) newCommit(parent *commit, message string, changes map[string]string) *commit {
+	p.s.now = p.s.now.Add(time.Minute)
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s %d %s", p.info.PathWithNamespace, len(p.commits), message)))
+	id := hex.EncodeToString(sum[:])
+	c := &commit{
+		Commit: gitlab.Commit{
+			ID:            id,
+			ShortID:       id[:8],
+			CreatedAt:     p.s.now,
+			Title:         strings.SplitN(message, "\n", 2)[0],
+			Message:       message,
+			AuthorName:    p.s.User.Name,
+			AuthorEmail:   p.s.User.Username + "@example.com",
+			AuthorDate:    p.s.now.Format(time.RFC3339),
+			CommitterName: p.s.User.Name,
+			CommittedDate: p.s.now,
+			WebURL:        fmt.Sprintf("%s/-/commit/%s", p.info.WebURL, id),
+		},
+		parent: parent,
+		files:  map[string]*file{},
+	}
+	if parent != nil {
+		for path, f := range parent.files {
+			c.files[path] = f
+		}
+	}
+	for path, content := range changes {
+		if content == "" {
+			delete(c.files, path)
+			continue
+		}
+		c.files[path] = &file{content: content, lastCommitID: id}
+	}
+	p.commits[id] = c
+	return c
+}
+
+// resolve returns the commit of a branch, a tag or a commit SHA.
+func (p *Project) resolve(ref string) *commit {
+	if ref == "" {
+		ref = p.info.DefaultBranch
+	}
+	if b, ok := p.branches[ref]; ok {
+		return b.head
+	}
+	if t, ok := p.tags[ref]; ok {
+		return p.commits[t.Target]
+	}
+	if c, ok := p.commits[ref]; ok {
+		return c
+	}
+	for id, c := range p.commits {
+		if len(ref) >= 7 && strings.HasPrefix(id, ref) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Commit adds a commit to the branch which changes the files, an empty content deletes the file.
+// The branch is created from the default branch if it does not exist.
+func (p *Project) Commit(branchName, message string, files map[string]string) gitlab.Commit {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	b, ok := p.branches[branchName]
+	if !ok {
+		b = &branch{name: branchName, head: p.branches[p.info.DefaultBranch].head}
+		p.branches[branchName] = b
+	}
+	b.head = p.newCommit(b.head, message, files)
+	return b.head.Commit
+}
+
+// Merge adds the merge request as merged into its target branch, the default branch if not set,
+// with a merge commit changing the files. The merge request is returned with its IID.
+func (p *Project) Merge(mr gitlab.MergeRequest, files map[string]string) gitlab.MergeRequest {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	if mr.TargetBranch == "" {
+		mr.TargetBranch = p.info.DefaultBranch
+	}
+	if mr.SourceBranch == "" {
+		mr.SourceBranch = fmt.Sprintf("feature-%d", len(p.mrs)+1)
+	}
+	m := p.addMergeRequest(mr)
+	for path := range files {
+		m.changes = append(m.changes, gitlab.MergeRequestChange{OldPath: path, NewPath: path})
+	}
+	sort.Slice(m.changes, func(i, j int) bool {
+		return m.changes[i].NewPath < m.changes[j].NewPath
+	})
+	p.merge(m, files)
+	return m.MergeRequest
+}
+
+func (p *Project) merge(m *mergeRequest, files map[string]string) {
+	target, ok := p.branches[m.TargetBranch]
+	if !ok {
+		target = &branch{name: m.TargetBranch, head: p.branches[p.info.DefaultBranch].head}
+		p.branches[m.TargetBranch] = target
+	}
+	if source, ok := p.branches[m.SourceBranch]; ok && files == nil {
+		files = map[string]string{}
+		for path, f := range source.head.files {
+			if old, ok := target.head.files[path]; !ok || old.content != f.content {
+				files[path] = f.content
+			}
+		}
+	}
+	message := fmt.Sprintf("Merge branch '%s' into '%s'\n\n%s\n\nSee merge request %s!%d",
+		m.SourceBranch, m.TargetBranch, m.Title, p.info.PathWithNamespace, m.IID)
+	target.head = p.newCommit(target.head, message, files)
+	m.State = "merged"
+	m.MergedAt = p.s.now
+	m.UpdatedAt = p.s.now
+	m.MergeCommitSHA = target.head.ID
+}
+
+func (p *Project) addMergeRequest(mr gitlab.MergeRequest) *mergeRequest {
+	mr.IID = len(p.mrs) + 1
+	p.s.lastID++
+	mr.ID = p.s.lastID
+	mr.ProjectID = p.info.ID
+	if mr.State == "" {
+		mr.State = "opened"
+	}
+	if mr.Author.Username == "" {
+		mr.Author = p.s.User
+	}
+	if mr.CreatedAt.IsZero() {
+		mr.CreatedAt = p.s.now
+	}
+	mr.UpdatedAt = p.s.now
+	mr.WebURL = fmt.Sprintf("%s/-/merge_requests/%d", p.info.WebURL, mr.IID)
+	m := &mergeRequest{MergeRequest: mr}
+	p.mrs = append(p.mrs, m)
+	return m
+}
+
+func (p *Project) mergeRequest(iid int) *mergeRequest {
+	if iid < 1 || iid > len(p.mrs) {
+		return nil
+	}
+	return p.mrs[iid-1]
+}
+
+// MergeRequests returns all merge requests of the project.
+func (p *Project) MergeRequests() []gitlab.MergeRequest {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	var mrs []gitlab.MergeRequest
+	for _, m := range p.mrs {
+		mrs = append(mrs, m.MergeRequest)
+	}
+	return mrs
+}
+
+// Tag creates the tag at the ref, a branch, a tag or a commit SHA.
+func (p *Project) Tag(name, ref string) gitlab.Tag {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	t, err := p.createTag(name, ref, "")
+	if err != nil {
+		panic(err)
+	}
+	return *t
+}
+
+func (p *Project) createTag(name, ref, message string) (*gitlab.Tag, error) {
+	if _, ok := p.tags[name]; ok {
+		return nil, fmt.Errorf("Tag %s already exists", name)
+	}
+	c := p.resolve(ref)
+	if c == nil {
+		return nil, fmt.Errorf("Target %s is invalid", ref)
+	}
+	t := &gitlab.Tag{
+		Name:    name,
+		Target:  c.ID,
+		Message: message,
+		Commit:  c.Commit,
+	}
+	p.tags[name] = t
+	return t, nil
+}
+
+// tag returns the tag with its release.
+func (p *Project) tag(name string) *gitlab.Tag {
+	t, ok := p.tags[name]
+	if !ok {
+		return nil
+	}
+	tag := *t
+	// tags embed only the tag name and description of their release
+	if release := p.releases[name]; release != nil {
+		tag.Release = &gitlab.Release{TagName: release.TagName, Description: release.Description}
+	}
+	return &tag
+}
+
+// Release creates or updates the release of the tag.
+func (p *Project) Release(tagName, description string) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	if release := p.releases[tagName]; release != nil {
+		release.Description = description
+		return
+	}
+	p.releases[tagName] = &gitlab.Release{TagName: tagName, Name: tagName, Description: description, CreatedAt: p.s.now, ReleasedAt: p.s.now}
+}
+
+// PackageFile returns the content of the file of the generic package, false if it does not exist.
+func (p *Project) PackageFile(name, version, fileName string) ([]byte, bool) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	content, ok := p.packages[name+"/"+version+"/"+fileName]
+	return content, ok
+}
+
+// Releases returns the releases by tag name.
+func (p *Project) Releases() map[string]gitlab.Release {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	releases := map[string]gitlab.Release{}
+	for name, r := range p.releases {
+		releases[name] = *r
+	}
+	return releases
+}
+
+// File returns the content of the file at the ref, false if it does not exist.
+func (p *Project) File(ref, path string) (string, bool) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	c := p.resolve(ref)
+	if c == nil {
+		return "", false
+	}
+	f, ok := c.files[path]
+	if !ok {
+		return "", false
+	}
+	return f.content, true
+}
+
+// CommitRequests returns the requests of the commits API which created commits, in order.
+func (p *Project) CommitRequests() []gitlab.CommitRequest {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	return append([]gitlab.CommitRequest{}, p.commitRequests...)
+}
+
+// Branches returns the names of the branches.
+func (p *Project) Branches() []string {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	var names []string
+	for name := range p.branches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProtectTag protects the tags matching the pattern, e.g. `v*`.
+func (p *Project) ProtectTag(pattern string, createAccessLevel int) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	p.protectedTags = append(p.protectedTags, gitlab.ProtectedTag{
+		Name:               pattern,
+		CreateAccessLevels: []gitlab.AccessLevelRule{{AccessLevel: createAccessLevel}},
+	})
+}
+
+// ProtectBranch protects the branches matching the pattern.
+func (p *Project) ProtectBranch(pattern string, pushAccessLevel, mergeAccessLevel int) {
+	p.s.mu.Lock()
+	defer p.s.mu.Unlock()
+	p.protectedBranches = append(p.protectedBranches, gitlab.ProtectedBranch{
+		Name:              pattern,
+		PushAccessLevels:  []gitlab.AccessLevelRule{{AccessLevel: pushAccessLevel}},
+		MergeAccessLevels: []gitlab.AccessLevelRule{{AccessLevel: mergeAccessLevel}},
+	})
+}
+
+// history returns the commits reachable from the commit, the newest first.
+func history(c *commit) []*commit {
+	var commits []*commit
+	for ; c != nil; c = c.parent {
+		commits = append(commits, c)
+	}
+	return commits
+}
+
+func (p *Project) branchInfo(b *branch) gitlab.Branch {
+	return gitlab.Branch{
+		Name:    b.name,
+		Default: b.name == p.info.DefaultBranch,
+		Commit:  b.head.Commit,
+		WebURL:  fmt.Sprintf("%s/-/tree/%s", p.info.WebURL, b.name),
+	}
+}
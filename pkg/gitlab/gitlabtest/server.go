@@ -0,0 +1,386 @@
+// Package gitlabtest provides an in-memory fake GitLab server for tests of code using gitlab.Client.
+//
+// The server implements the projects, tags, releases, commits, merge requests, files and branches
+// endpoints used by walle, and the GraphQL query of merge requests. It paginates lists with the Link
+// header like GitLab does, and can be told to fail requests to test error handling:
+//
+//	s := gitlabtest.NewServer()
+//	defer s.Close()
+//	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+//	p.Merge(gitlab.MergeRequest{Title: "feat: add login"}, map[string]string{"login.go": "package app"})
+//	p.Tag("v1.0.0", "master")
+//	client := s.Client()
+package gitlabtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/semver"
+)
+
+const (
+	apiPrefix      = "/api/v4"
+	graphQLPath    = "/api/graphql"
+	defaultPerPage = 20
+	maxPerPage     = 100
+)
+
+// Server is a fake GitLab, create it with NewServer and close it when done.
+type Server struct {
+	*httptest.Server
+
+	// Token is required in the PRIVATE-TOKEN, JOB-TOKEN or Authorization header if it is not empty.
+	Token string
+	// Scopes are the scopes of the token returned by /personal_access_tokens/self.
+	Scopes []string
+	User   gitlab.User
+	// Version selects the release endpoints: the Releases API since 11.7, the release of tags before 15.0.
+	Version gitlab.Version
+	// PerPage is the default page size, GitLab uses 20.
+	PerPage int
+	// RetryAfter is the Retry-After header in seconds of failures with 429 Too Many Requests.
+	RetryAfter int
+	// MaxPerPage limits the page size requested by per_page, GitLab uses 100. Lower it to test pagination.
+	MaxPerPage int
+
+	mu       sync.Mutex
+	now      time.Time
+	lastID   int
+	projects []*Project
+	failures []*failure
+	requests []string
+}
+
+type failure struct {
+	method string
+	path   string
+	status int
+	times  int
+}
+
+// NewServer starts a fake GitLab with no projects.
+func NewServer() *Server {
+	s := &Server{
+		Scopes:     []string{"api", "read_api", "read_repository", "write_repository"},
+		User:       gitlab.User{ID: 1, Name: "Administrator", Username: "root"},
+		Version:    gitlab.Version{Version: "15.11.0", Revision: "fake"},
+		PerPage:    defaultPerPage,
+		MaxPerPage: maxPerPage,
+		now:        time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		lastID:     100,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Config is the config of a client connecting to the server.
+type Config struct {
+	APIBase string
+	Token   string
+	// AuthType is how the token is sent, see gitlab.AuthBearer.
+	AuthType string
+}
+
+func (c *Config) GetAPIBase() string {
+	return c.APIBase
+}
+
+func (c *Config) GetToken() string {
+	return c.Token
+}
+
+func (c *Config) GetAuthType() string {
+	return c.AuthType
+}
+
+// GetRetryDelay makes retries of failed requests fast.
+func (c *Config) GetRetryDelay() time.Duration {
+	return time.Millisecond
+}
+
+// APIBase returns the base URL of the API, e.g. `http://127.0.0.1:1234/api/v4`.
+func (s *Server) APIBase() string {
+	return s.URL + apiPrefix
+}
+
+// Config returns the config of a client connecting to the server with its token.
+func (s *Server) Config() *Config {
+	return &Config{APIBase: s.APIBase(), Token: s.Token}
+}
+
+// Client returns a client connecting to the server.
+func (s *Server) Client() gitlab.Client {
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	return gitlab.NewClient(logrus.NewEntry(logger), s.Config())
+}
+
+// Project returns the project by its path or ID, nil if it does not exist.
+func (s *Server) Project(id string) *Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.project(id)
+}
+
+func (s *Server) project(id string) *Project {
+	for _, p := range s.projects {
+		if p.info.PathWithNamespace == id || strconv.Itoa(p.info.ID) == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// Fail makes the next times requests with the method, and the path starting with the prefix,
+// respond with the status code. The path is relative to /api/v4 and not escaped, e.g. `/projects/group/app/repository/tags`,
+// except `/api/graphql` for GraphQL.
+// A negative times fails the requests forever.
+func (s *Server) Fail(method, pathPrefix string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: pathPrefix, status: status, times: times})
+}
+
+// Requests returns the requests served, e.g. `GET /projects/group/app/repository/tags?page=2`.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// ResetRequests clears the served requests.
+func (s *Server) ResetRequests() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+func (s *Server) fail(method, path string) int {
+	for _, f := range s.failures {
+		if f.times == 0 || f.method != method || !strings.HasPrefix(path, f.path) {
+			continue
+		}
+		if f.times > 0 {
+			f.times--
+		}
+		return f.status
+	}
+	return 0
+}
+
+// before reports whether the Version of the server is older than major.minor.
+func (s *Server) before(major, minor int) bool {
+	v, ok := semver.Parse(s.Version.Version)
+	return ok && semver.Compare(v, semver.Version{Major: major, Minor: minor}) < 0
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	for _, token := range []string{
+		r.Header.Get("PRIVATE-TOKEN"),
+		r.Header.Get("JOB-TOKEN"),
+		strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "),
+	} {
+		if token == s.Token {
+			return true
+		}
+	}
+	return false
+}
+
+// segments returns the unescaped segments of the path after the API prefix,
+// e.g. `group/app` is one segment of `/projects/group%2Fapp/repository/tags`.
+func segments(r *http.Request) ([]string, bool) {
+	escaped := r.URL.EscapedPath()
+	if !strings.HasPrefix(escaped, apiPrefix+"/") {
+		return nil, false
+	}
+	var segs []string
+	for _, seg := range strings.Split(strings.TrimPrefix(escaped, apiPrefix+"/"), "/") {
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil {
+			return nil, false
+		}
+		segs = append(segs, unescaped)
+	}
+	return segs, true
+}
+
+// serveHTTP serves the request, successful GET responses have an ETag and are revalidated with If-None-Match.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := httptest.NewRecorder()
+	s.serveAPI(rec, r)
+	for name, values := range rec.Header() {
+		w.Header()[name] = values
+	}
+	if r.Method != http.MethodGet || rec.Code != http.StatusOK {
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+		return
+	}
+	sum := sha1.Sum(rec.Body.Bytes())
+	etag := fmt.Sprintf(`W/"%s"`, hex.EncodeToString(sum[:]))
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+func (s *Server) serveAPI(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var path string
+	segs, ok := segments(r)
+	if ok {
+		path = "/" + strings.Join(segs, "/")
+	} else if r.URL.Path == graphQLPath {
+		path = graphQLPath
+	} else {
+		writeError(w, http.StatusNotFound, "404 Not Found")
+		return
+	}
+	request := r.Method + " " + path
+	if r.URL.RawQuery != "" {
+		request += "?" + r.URL.RawQuery
+	}
+	s.requests = append(s.requests, request)
+
+	if status := s.fail(r.Method, path); status != 0 {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+		}
+		writeError(w, status, fmt.Sprintf("%d %s", status, http.StatusText(status)))
+		return
+	}
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "401 Unauthorized")
+		return
+	}
+
+	switch {
+	case path == graphQLPath && r.Method == http.MethodPost:
+		s.serveGraphQL(w, r)
+	case len(segs) == 1 && segs[0] == "version":
+		writeJSON(w, http.StatusOK, s.Version)
+	case len(segs) == 1 && segs[0] == "user":
+		writeJSON(w, http.StatusOK, s.User)
+	case len(segs) == 2 && segs[0] == "personal_access_tokens" && segs[1] == "self":
+		writeJSON(w, http.StatusOK, gitlab.PersonalAccessToken{ID: 1, Name: "walle", Active: true, Scopes: s.Scopes})
+	case len(segs) >= 2 && segs[0] == "projects":
+		p := s.project(segs[1])
+		if p == nil {
+			writeError(w, http.StatusNotFound, "404 Project Not Found")
+			return
+		}
+		p.serveHTTP(w, r, segs[2:])
+	default:
+		writeError(w, http.StatusNotFound, "404 Not Found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(obj)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+// paginate writes the page of the items, a slice, with the pagination headers of GitLab.
+// Offset pagination is used by default, `pagination=keyset` returns only the next link without totals.
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, items interface{}) {
+	v := reflect.ValueOf(items)
+	query := r.URL.Query()
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = s.PerPage
+	}
+	if perPage > s.MaxPerPage {
+		perPage = s.MaxPerPage
+	}
+	total := v.Len()
+	totalPages := (total + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	keyset := query.Get("pagination") == "keyset"
+	var start int
+	if keyset {
+		start, _ = strconv.Atoi(query.Get("page_token"))
+	} else {
+		page, err := strconv.Atoi(query.Get("page"))
+		if err != nil || page <= 0 {
+			page = 1
+		}
+		start = (page - 1) * perPage
+		w.Header().Set("X-Page", strconv.Itoa(page))
+		w.Header().Set("X-Per-Page", strconv.Itoa(perPage))
+		w.Header().Set("X-Total", strconv.Itoa(total))
+		w.Header().Set("X-Total-Pages", strconv.Itoa(totalPages))
+		if page < totalPages {
+			w.Header().Set("X-Next-Page", strconv.Itoa(page+1))
+		}
+		if page > 1 {
+			w.Header().Set("X-Prev-Page", strconv.Itoa(page-1))
+		}
+	}
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+
+	link := func(key, value string) string {
+		q := r.URL.Query()
+		q.Set(key, value)
+		q.Set("per_page", strconv.Itoa(perPage))
+		return fmt.Sprintf("<%s%s?%s>", s.URL, r.URL.EscapedPath(), q.Encode())
+	}
+	var links []string
+	if keyset {
+		if end < total {
+			links = append(links, link("page_token", strconv.Itoa(end))+`; rel="next"`)
+		}
+	} else {
+		page := start/perPage + 1
+		if page > 1 {
+			links = append(links, link("page", strconv.Itoa(page-1))+`; rel="prev"`)
+		}
+		if page < totalPages {
+			links = append(links, link("page", strconv.Itoa(page+1))+`; rel="next"`)
+		}
+		links = append(links, link("page", "1")+`; rel="first"`, link("page", strconv.Itoa(totalPages))+`; rel="last"`)
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+
+	page := reflect.MakeSlice(v.Type(), 0, end-start)
+	page = reflect.AppendSlice(page, v.Slice(start, end))
+	writeJSON(w, http.StatusOK, page.Interface())
+}
@@ -0,0 +1,223 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	graphQLPath = "/api/graphql"
+	// graphQLBatchSize is the maximum page size of GraphQL connections.
+	graphQLBatchSize = 100
+)
+
+const mergeRequestsQuery = `query($fullPath: ID!, $iids: [String!], $first: Int, $withChanges: Boolean!) {
+  project(fullPath: $fullPath) {
+    mergeRequests(iids: $iids, first: $first) {
+      nodes {
+        iid
+        title
+        description
+        state
+        createdAt
+        updatedAt
+        mergedAt
+        webUrl
+        sourceBranch
+        targetBranch
+        mergeCommitSha
+        labels { nodes { title } }
+        author { id name username avatarUrl webUrl }
+        closingIssues { nodes { iid title webUrl } }
+        diffStats @include(if: $withChanges) { path }
+      }
+    }
+  }
+}`
+
+// GraphQLError is an error in the `errors` field of a GraphQL response.
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+func (e *GraphQLError) Error() string {
+	return "graphql: " + e.Message
+}
+
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// endpoint returns the URL of the path, which is relative to the API base except for GraphQL.
+func (c *client) endpoint(path string) string {
+	base := c.getAPIBase()
+	if path == graphQLPath {
+		return strings.TrimSuffix(strings.TrimSuffix(base, "/"), "/api/v4") + graphQLPath
+	}
+	return base + path
+}
+
+// graphQL runs the query, data is decoded from the `data` field of the response.
+func (c *client) graphQL(query string, variables map[string]interface{}, data interface{}) error {
+	resp := struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []GraphQLError  `json:"errors"`
+	}{}
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        graphQLPath,
+		requestBody: &graphQLRequest{Query: query, Variables: variables},
+		exitCodes:   []int{200},
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return &resp.Errors[0]
+	}
+	return json.Unmarshal(resp.Data, data)
+}
+
+type graphQLMergeRequest struct {
+	IID            string     `json:"iid"`
+	Title          string     `json:"title"`
+	Description    string     `json:"description"`
+	State          string     `json:"state"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	MergedAt       *time.Time `json:"mergedAt"`
+	WebURL         string     `json:"webUrl"`
+	SourceBranch   string     `json:"sourceBranch"`
+	TargetBranch   string     `json:"targetBranch"`
+	MergeCommitSHA string     `json:"mergeCommitSha"`
+	Labels         struct {
+		Nodes []struct {
+			Title string `json:"title"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Author *struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		Username  string `json:"username"`
+		AvatarURL string `json:"avatarUrl"`
+		WebURL    string `json:"webUrl"`
+	} `json:"author"`
+	ClosingIssues struct {
+		Nodes []struct {
+			IID    string `json:"iid"`
+			Title  string `json:"title"`
+			WebURL string `json:"webUrl"`
+		} `json:"nodes"`
+	} `json:"closingIssues"`
+	DiffStats []struct {
+		Path string `json:"path"`
+	} `json:"diffStats"`
+}
+
+func (g *graphQLMergeRequest) mergeRequest() (MergeRequestWithChanges, error) {
+	iid, err := strconv.Atoi(g.IID)
+	if err != nil {
+		return MergeRequestWithChanges{}, fmt.Errorf("invalid iid %q: %v", g.IID, err)
+	}
+	mr := MergeRequest{
+		IID:            iid,
+		Title:          g.Title,
+		Description:    g.Description,
+		State:          g.State,
+		CreatedAt:      g.CreatedAt,
+		UpdatedAt:      g.UpdatedAt,
+		WebURL:         g.WebURL,
+		SourceBranch:   g.SourceBranch,
+		TargetBranch:   g.TargetBranch,
+		MergeCommitSHA: g.MergeCommitSHA,
+	}
+	if g.MergedAt != nil {
+		mr.MergedAt = *g.MergedAt
+	}
+	for _, l := range g.Labels.Nodes {
+		mr.Labels = append(mr.Labels, l.Title)
+	}
+	if g.Author != nil {
+		// global IDs look like gid://gitlab/User/1
+		id, _ := strconv.Atoi(g.Author.ID[strings.LastIndex(g.Author.ID, "/")+1:])
+		mr.Author = User{
+			ID:        id,
+			Name:      g.Author.Name,
+			Username:  g.Author.Username,
+			AvatarURL: g.Author.AvatarURL,
+			WebURL:    g.Author.WebURL,
+		}
+	}
+	for _, issue := range g.ClosingIssues.Nodes {
+		issueIID, err := strconv.Atoi(issue.IID)
+		if err != nil {
+			return MergeRequestWithChanges{}, fmt.Errorf("invalid iid %q of a closing issue: %v", issue.IID, err)
+		}
+		mr.ClosingIssues = append(mr.ClosingIssues, Issue{IID: issueIID, Title: issue.Title, WebURL: issue.WebURL})
+	}
+	result := MergeRequestWithChanges{MergeRequest: mr}
+	for _, d := range g.DiffStats {
+		result.Changes = append(result.Changes, MergeRequestChange{OldPath: d.Path, NewPath: d.Path})
+	}
+	return result, nil
+}
+
+// ListMergeRequestsByIID returns the merge requests with the IIDs by GraphQL, 100 in a query.
+// Merge requests which do not exist are not returned. Changes are only the new paths of files,
+// they are requested only if withChanges is true. Queries are POST requests, they are not cached.
+func (c *client) ListMergeRequestsByIID(project string, iids []int, withChanges bool) ([]MergeRequestWithChanges, error) {
+	c.log("ListMergeRequestsByIID", project, len(iids))
+	fullPath := project
+	if _, err := strconv.Atoi(project); err == nil {
+		// GraphQL finds projects by path only
+		p, err := c.GetProject(project)
+		if err != nil {
+			return nil, err
+		}
+		fullPath = p.PathWithNamespace
+	}
+
+	var mrs []MergeRequestWithChanges
+	for start := 0; start < len(iids); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(iids) {
+			end = len(iids)
+		}
+		var batch []string
+		for _, iid := range iids[start:end] {
+			batch = append(batch, strconv.Itoa(iid))
+		}
+		data := struct {
+			Project *struct {
+				MergeRequests struct {
+					Nodes []graphQLMergeRequest `json:"nodes"`
+				} `json:"mergeRequests"`
+			} `json:"project"`
+		}{}
+		err := c.graphQL(mergeRequestsQuery, map[string]interface{}{
+			"fullPath":    fullPath,
+			"iids":        batch,
+			"first":       len(batch),
+			"withChanges": withChanges,
+		}, &data)
+		if err != nil {
+			return nil, err
+		}
+		if data.Project == nil {
+			return nil, fmt.Errorf("graphql: project %s not found", fullPath)
+		}
+		for i := range data.Project.MergeRequests.Nodes {
+			mr, err := data.Project.MergeRequests.Nodes[i].mergeRequest()
+			if err != nil {
+				return nil, err
+			}
+			mrs = append(mrs, mr)
+		}
+	}
+	return mrs, nil
+}
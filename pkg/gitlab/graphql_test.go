@@ -0,0 +1,45 @@
+package gitlab_test
+
+import (
+	"reflect"
+	"testing"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestListMergeRequestsByIID(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	issue := gitlab.Issue{IID: 7, Title: "login fails", WebURL: p.Info().WebURL + "/-/issues/7"}
+	p.Merge(gitlab.MergeRequest{
+		Title:         "fix: login",
+		Description:   "Closes #7",
+		Labels:        []string{"bug"},
+		ClosingIssues: []gitlab.Issue{issue},
+	}, map[string]string{"login.go": "fixed"})
+	p.Merge(gitlab.MergeRequest{Title: "docs: readme"}, nil)
+
+	mrs, err := s.Client().ListMergeRequestsByIID("group/app", []int{1, 2, 3}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mrs) != 2 {
+		t.Fatalf("got %d merge requests, want the 2 existing ones", len(mrs))
+	}
+	mr := mrs[0]
+	if mr.IID != 1 || mr.Title != "fix: login" || mr.Description != "Closes #7" ||
+		!reflect.DeepEqual(mr.Labels, []string{"bug"}) || mr.Author.Username != "root" {
+		t.Errorf("got merge request %+v", mr.MergeRequest)
+	}
+	if !reflect.DeepEqual(mr.ClosingIssues, []gitlab.Issue{issue}) {
+		t.Errorf("got closing issues %+v, want %+v", mr.ClosingIssues, issue)
+	}
+	if len(mr.Changes) != 1 || mr.Changes[0].NewPath != "login.go" {
+		t.Errorf("got changes %+v", mr.Changes)
+	}
+	if len(mrs[1].ClosingIssues) != 0 {
+		t.Errorf("got closing issues %+v of !2", mrs[1].ClosingIssues)
+	}
+}
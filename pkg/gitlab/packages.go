@@ -0,0 +1,30 @@
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// PackageClient uploads files to the generic package registry, https://docs.gitlab.com/ee/user/packages/generic_packages/.
+type PackageClient interface {
+	// UploadGenericPackageFile uploads the file to the package of the version, and returns the URL to download it.
+	UploadGenericPackageFile(project, name, version, fileName string, content []byte) (string, error)
+}
+
+func (c *client) UploadGenericPackageFile(project, name, version, fileName string, content []byte) (string, error) {
+	path := fmt.Sprintf(
+		"/projects/%s/packages/generic/%s/%s/%s",
+		url.PathEscape(project),
+		url.PathEscape(name),
+		url.PathEscape(version),
+		url.PathEscape(fileName),
+	)
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        path,
+		requestBody: content,
+		exitCodes:   []int{200, 201},
+	}, nil)
+	return c.getAPIBase() + path, err
+}
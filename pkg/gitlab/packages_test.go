@@ -0,0 +1,35 @@
+package gitlab_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestUploadGenericPackageFile(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	s.Fail(http.MethodPut, "/projects/group/app/packages", http.StatusBadGateway, 1)
+
+	content := []byte{0x7f, 'E', 'L', 'F', 0, 0xff}
+	url, err := s.Client().UploadGenericPackageFile("group/app", "app", "v1.0.0", "app-linux-amd64", content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uploaded, _ := p.PackageFile("app", "v1.0.0", "app-linux-amd64"); string(uploaded) != string(content) {
+		t.Errorf("got uploaded %q, want %q after retrying", uploaded, content)
+	}
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if downloaded, _ := ioutil.ReadAll(resp.Body); string(downloaded) != string(content) {
+		t.Errorf("got %q from %s, want %q", downloaded, url, content)
+	}
+}
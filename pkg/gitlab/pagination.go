@@ -0,0 +1,225 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"walle/pkg/utils"
+)
+
+const defaultPerPage = 100
+
+// ListOptions controls how lists are paginated.
+type ListOptions struct {
+	// PerPage is the page size, 100 by default.
+	PerPage int
+	// MaxItems stops listing after the number of items, no limit if it is 0.
+	MaxItems int
+	// Keyset uses keyset pagination, which is faster for large lists but supported only by some endpoints
+	// and orderings, see https://docs.gitlab.com/ee/api/rest/#keyset-based-pagination.
+	Keyset  bool
+	OrderBy string
+	Sort    string
+}
+
+func (o ListOptions) values(values url.Values) url.Values {
+	paged := url.Values{}
+	for k, v := range values {
+		paged[k] = v
+	}
+	perPage := o.PerPage
+	if perPage <= 0 {
+		perPage = defaultPerPage
+	}
+	paged.Set("per_page", strconv.Itoa(perPage))
+	if o.Keyset {
+		paged.Set("pagination", "keyset")
+	}
+	if o.OrderBy != "" {
+		paged.Set("order_by", o.OrderBy)
+	}
+	if o.Sort != "" {
+		paged.Set("sort", o.Sort)
+	}
+	return paged
+}
+
+// Page describes a page of a list.
+type Page struct {
+	// Number is the page number from 1, 0 for keyset pagination.
+	Number int
+	// TotalPages and Total are 0 if GitLab does not count them,
+	// e.g. for keyset pagination or lists with more than 10,000 items.
+	TotalPages int
+	Total      int
+}
+
+func pageOf(header http.Header) Page {
+	atoi := func(name string) int {
+		n, _ := strconv.Atoi(header.Get(name))
+		return n
+	}
+	return Page{
+		Number:     atoi("X-Page"),
+		TotalPages: atoi("X-Total-Pages"),
+		Total:      atoi("X-Total"),
+	}
+}
+
+// readPages requests the pages of the list one by one, newObj returns a pointer to a slice to decode a page into.
+// The next page is requested only after onPage returns true, so callers can stop early.
+func (c *client) readPages(path string, values url.Values, opts ListOptions,
+	newObj func() interface{}, onPage func(obj interface{}, page Page) bool,
+) error {
+	return c.followPages(path+"?"+opts.values(values).Encode(), opts.MaxItems, newObj, onPage)
+}
+
+// followPages reads the page of pagedPath and the pages of its next links.
+func (c *client) followPages(pagedPath string, maxItems int,
+	newObj func() interface{}, onPage func(obj interface{}, page Page) bool,
+) error {
+	var count int
+	for pagedPath != "" {
+		obj, header, err := c.readPage(pagedPath, newObj)
+		if err != nil {
+			return err
+		}
+
+		items := reflect.ValueOf(obj).Elem()
+		if maxItems > 0 && count+items.Len() > maxItems {
+			items.Set(items.Slice(0, maxItems-count))
+		}
+		count += items.Len()
+		if !onPage(obj, pageOf(header)) || maxItems > 0 && count >= maxItems {
+			return nil
+		}
+
+		// the next link keeps the query, including the cursor of keyset pagination
+		if pagedPath, err = c.nextPath(parseLinks(header.Get("Link"))["next"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readAllPages reads all pages of the list. When GitLab counts the pages in X-Total-Pages,
+// the pages after the first one are requested concurrently by pageWorkers workers, and accumulated in order.
+func (c *client) readAllPages(path string, values url.Values, newObj func() interface{}, accumulate func(interface{})) error {
+	paged := ListOptions{}.values(values)
+	first, header, err := c.readPage(path+"?"+paged.Encode(), newObj)
+	if err != nil {
+		return err
+	}
+	accumulate(first)
+
+	totalPages := pageOf(header).TotalPages
+	if totalPages <= 1 || c.pageWorkers <= 1 {
+		// GitLab does not count lists with more than 10,000 items, follow the next links
+		next, err := c.nextPath(parseLinks(header.Get("Link"))["next"])
+		if err != nil {
+			return err
+		}
+		return c.followPages(next, 0, newObj, func(obj interface{}, _ Page) bool {
+			accumulate(obj)
+			return true
+		})
+	}
+
+	workers := c.pageWorkers
+	if workers > totalPages-1 {
+		workers = totalPages - 1
+	}
+	results := make([]interface{}, totalPages+1)
+	pages := make(chan int)
+	var lock sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for n := range pages {
+				lock.Lock()
+				failed := firstErr != nil
+				lock.Unlock()
+				if failed {
+					continue
+				}
+				pageValues := url.Values{}
+				for k, v := range paged {
+					pageValues[k] = v
+				}
+				pageValues.Set("page", strconv.Itoa(n))
+				obj, _, err := c.readPage(path+"?"+pageValues.Encode(), newObj)
+				lock.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				results[n] = obj
+				lock.Unlock()
+			}
+		}()
+	}
+	for n := 2; n <= totalPages; n++ {
+		pages <- n
+	}
+	close(pages)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	for _, obj := range results[2:] {
+		accumulate(obj)
+	}
+	return nil
+}
+
+// nextPath returns the path of the next link relative to the API base, empty if it is the last page.
+// The host of the link is ignored, it is the external URL of GitLab which may differ from the configured host.
+func (c *client) nextPath(link string) (string, error) {
+	if link == "" {
+		return "", nil
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse 'next' link: %v", err)
+	}
+	base, err := url.Parse(c.getAPIBase())
+	if err != nil {
+		return "", err
+	}
+	basePath := strings.TrimSuffix(base.EscapedPath(), "/")
+	uri := u.RequestURI()
+	if !strings.HasPrefix(uri, basePath+"/") {
+		return "", fmt.Errorf("'next' link %s is not under %s", link, basePath)
+	}
+	return strings.TrimPrefix(uri, basePath), nil
+}
+
+// readPage requests the page and closes its body before returning.
+func (c *client) readPage(path string, newObj func() interface{}) (interface{}, http.Header, error) {
+	resp, err := c.requestRetry(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer utils.CloseSilently(resp.Body)
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, newAPIError(http.MethodGet, path, resp.StatusCode, b)
+	}
+	obj := newObj()
+	if err = json.Unmarshal(b, obj); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode page of %s: %v", path, err)
+	}
+	return obj, resp.Header, nil
+}
@@ -0,0 +1,59 @@
+package gitlab
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimit is shared by all requests of the client, when GitLab rejects a request with 429,
+// or reports no remaining requests, the requests wait until the limit resets.
+type rateLimit struct {
+	mu    sync.Mutex
+	reset time.Time
+}
+
+// waitRateLimit sleeps until the rate limit resets, at most maxSleepTime.
+func (c *client) waitRateLimit() {
+	c.rateLimit.mu.Lock()
+	reset := c.rateLimit.reset
+	c.rateLimit.mu.Unlock()
+	if reset.IsZero() {
+		return
+	}
+	d := c.time.Until(reset)
+	if d <= 0 {
+		return
+	}
+	if d > c.maxSleepTime {
+		d = c.maxSleepTime
+	}
+	c.logger.WithField("wait", d.String()).Debug("Waiting for the rate limit to reset")
+	c.time.Sleep(d)
+}
+
+// updateRateLimit reads the rate limit headers of the response, backoff is the wait of 429 without headers.
+func (c *client) updateRateLimit(resp *http.Response, backoff time.Duration) {
+	var reset time.Time
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && resp.StatusCode == http.StatusTooManyRequests {
+		reset = c.time.Now().Add(time.Duration(seconds) * time.Second)
+	} else if unix, err := strconv.ParseInt(resp.Header.Get("RateLimit-Reset"), 10, 64); err == nil &&
+		(resp.StatusCode == http.StatusTooManyRequests || resp.Header.Get("RateLimit-Remaining") == "0") {
+		reset = time.Unix(unix, 0)
+		// the reset is the time of the server, the wait is computed from its Date for clock skew
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			reset = c.time.Now().Add(reset.Sub(date))
+		}
+	} else if resp.StatusCode == http.StatusTooManyRequests {
+		reset = c.time.Now().Add(backoff)
+	} else {
+		return
+	}
+
+	c.rateLimit.mu.Lock()
+	defer c.rateLimit.mu.Unlock()
+	if reset.After(c.rateLimit.reset) {
+		c.rateLimit.reset = reset
+	}
+}
@@ -0,0 +1,152 @@
+package gitlab
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type fakeTime struct {
+	mu     sync.Mutex
+	sleeps []time.Duration
+	// now is the current time, the real time if it is zero.
+	now time.Time
+}
+
+func (f *fakeTime) Now() time.Time {
+	if f.now.IsZero() {
+		return time.Now()
+	}
+	return f.now
+}
+
+func (f *fakeTime) Sleep(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sleeps = append(f.sleeps, d)
+}
+
+func (f *fakeTime) Until(t time.Time) time.Duration {
+	return t.Sub(f.Now())
+}
+
+func TestRateLimit(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"version": "15.11.0"}`))
+		}
+	}))
+	defer server.Close()
+
+	ft := &fakeTime{}
+	c := &client{
+		logger: logrus.NewEntry(logrus.New()),
+		delegate: &delegate{
+			time:         ft,
+			client:       server.Client(),
+			maxRetries:   defaultMaxRetries,
+			initialDelay: time.Millisecond,
+			maxSleepTime: time.Minute,
+			getAPIBase: func() string {
+				return server.URL
+			},
+		},
+	}
+	version, err := c.GetVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.Version != "15.11.0" || requests != 2 {
+		t.Errorf("got version %s after %d requests", version.Version, requests)
+	}
+	if len(ft.sleeps) != 1 || ft.sleeps[0] != time.Minute {
+		t.Errorf("got sleeps %v, want to wait for the reset at most a minute", ft.sleeps)
+	}
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"version": "15.11.0"}`))
+		}
+	}))
+	defer server.Close()
+
+	// the reset is computed from the time of the client, the real time is far from it
+	ft := &fakeTime{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := &client{
+		logger: logrus.NewEntry(logrus.New()),
+		delegate: &delegate{
+			time:         ft,
+			client:       server.Client(),
+			maxRetries:   defaultMaxRetries,
+			initialDelay: time.Millisecond,
+			maxSleepTime: time.Minute,
+			getAPIBase: func() string {
+				return server.URL
+			},
+		},
+	}
+	if _, err := c.GetVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.sleeps) != 1 || ft.sleeps[0] != 30*time.Second {
+		t.Errorf("got sleeps %v, want to wait 30s of Retry-After", ft.sleeps)
+	}
+}
+
+func TestRateLimitResetSkewedClock(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch requests {
+		case 1:
+			now := time.Now()
+			w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(now.Unix()+30, 10))
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte(`{"version": "15.11.0"}`))
+		}
+	}))
+	defer server.Close()
+
+	// the clock of the client is years behind the server
+	ft := &fakeTime{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := &client{
+		logger: logrus.NewEntry(logrus.New()),
+		delegate: &delegate{
+			time:         ft,
+			client:       server.Client(),
+			maxRetries:   defaultMaxRetries,
+			initialDelay: time.Millisecond,
+			maxSleepTime: time.Minute,
+			getAPIBase: func() string {
+				return server.URL
+			},
+		},
+	}
+	if _, err := c.GetVersion(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ft.sleeps) != 1 || ft.sleeps[0] != 30*time.Second {
+		t.Errorf("got sleeps %v, want to wait 30s until the reset of the server", ft.sleeps)
+	}
+}
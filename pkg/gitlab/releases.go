@@ -0,0 +1,259 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"walle/pkg/semver"
+)
+
+// ErrReleaseNotFound is returned when the tag has no release.
+var ErrReleaseNotFound = errors.New("release not found")
+
+// Link types of release links, https://docs.gitlab.com/ee/user/project/releases/release_fields.html#link-types
+const (
+	LinkTypeOther   = "other"
+	LinkTypeRunbook = "runbook"
+	LinkTypePackage = "package"
+	LinkTypeImage   = "image"
+)
+
+// ValidateLinkType returns an error if the link type is not supported by GitLab, empty is other.
+func ValidateLinkType(linkType string) error {
+	switch linkType {
+	case "", LinkTypeOther, LinkTypeRunbook, LinkTypePackage, LinkTypeImage:
+		return nil
+	}
+	return fmt.Errorf("unknown link type %q, supported link types: %s, %s, %s, %s",
+		linkType, LinkTypeOther, LinkTypeRunbook, LinkTypePackage, LinkTypeImage)
+}
+
+// releasesAPISince is the version of GitLab adding the Releases API, older versions only have the release of tags.
+var releasesAPISince = semver.Version{Major: 11, Minor: 7}
+
+type releasesSupport struct {
+	once   sync.Once
+	legacy bool
+}
+
+// legacyReleases reports whether GitLab is older than the Releases API, the version is requested only once.
+// The Releases API is assumed if the version can not be read, e.g. by job tokens.
+func (c *client) legacyReleases() bool {
+	c.releases.once.Do(func() {
+		version, err := c.GetVersion()
+		if err != nil {
+			c.logger.WithError(err).Debug("Failed to get the version of GitLab, assuming the Releases API")
+			return
+		}
+		if v, ok := semver.Parse(version.Version); ok && semver.Compare(v, releasesAPISince) < 0 {
+			c.logger.WithField("version", version.Version).Debug("Using the release of tags of GitLab before 11.7")
+			c.releases.legacy = true
+		}
+	})
+	return c.releases.legacy
+}
+
+// errLegacyReleases is returned by operations GitLab before 11.7 does not support.
+func errLegacyReleases(operation string) error {
+	return fmt.Errorf("%s needs the Releases API of GitLab 11.7 or later", operation)
+}
+
+func releasePath(project, tagName string) string {
+	return fmt.Sprintf("/projects/%s/releases/%s", url.PathEscape(project), url.PathEscape(tagName))
+}
+
+// GetRelease returns the release of the tag, ErrReleaseNotFound is returned if the tag has no release.
+func (c *client) GetRelease(project, tagName string) (*Release, error) {
+	if c.legacyReleases() {
+		return c.getTagRelease(project, tagName)
+	}
+	path := releasePath(project, tagName)
+	code, b, err := c.requestRaw(&request{
+		method:    http.MethodGet,
+		path:      path,
+		exitCodes: []int{200, 404},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if code == http.StatusNotFound {
+		// a missing project, or a proxy in front of GitLab, responds 404 as well
+		apiErr := newAPIError(http.MethodGet, path, code, b)
+		if apiErr.Message != "404 Not Found" && apiErr.Message != "404 Release Not Found" {
+			return nil, apiErr
+		}
+		return nil, ErrReleaseNotFound
+	}
+	release := &Release{}
+	if err = json.Unmarshal(b, release); err != nil {
+		return nil, err
+	}
+	return release, nil
+}
+
+// ListReleases returns the releases, the newest first.
+func (c *client) ListReleases(project string) ([]Release, error) {
+	if c.legacyReleases() {
+		tags, err := c.ListTags(project)
+		if err != nil {
+			return nil, err
+		}
+		var releases []Release
+		for _, tag := range tags {
+			if tag.Release != nil {
+				releases = append(releases, *tag.Release)
+			}
+		}
+		return releases, nil
+	}
+	var releases []Release
+	err := c.readAllPages(
+		fmt.Sprintf("/projects/%s/releases", url.PathEscape(project)),
+		nil,
+		func() interface{} {
+			return &[]Release{}
+		},
+		func(obj interface{}) {
+			releases = append(releases, *obj.(*[]Release)...)
+		},
+	)
+	return releases, err
+}
+
+// CreateRelease creates the release, and its tag from req.Ref if the tag does not exist.
+func (c *client) CreateRelease(project string, req ReleaseRequest) (*Release, error) {
+	if c.legacyReleases() {
+		return c.createTagRelease(project, req)
+	}
+	release := &Release{}
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        fmt.Sprintf("/projects/%s/releases", url.PathEscape(project)),
+		requestBody: &req,
+		exitCodes:   []int{201},
+	}, release)
+	return release, err
+}
+
+// UpdateRelease updates the release of the tag, assets are updated by the release link APIs.
+func (c *client) UpdateRelease(project, tagName string, req ReleaseUpdate) (*Release, error) {
+	if c.legacyReleases() {
+		c.warnLegacyFields(req.Name, req.Milestones, req.ReleasedAt)
+		return c.tagRelease(http.MethodPut, project, tagName, req.Description)
+	}
+	release := &Release{}
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        releasePath(project, tagName),
+		requestBody: &req,
+		exitCodes:   []int{200},
+	}, release)
+	return release, err
+}
+
+// DeleteRelease deletes the release of the tag, the tag is not deleted.
+func (c *client) DeleteRelease(project, tagName string) error {
+	if c.legacyReleases() {
+		return errLegacyReleases("deleting releases")
+	}
+	_, err := c.request(&request{
+		method:    http.MethodDelete,
+		path:      releasePath(project, tagName),
+		exitCodes: []int{200},
+	}, nil)
+	return err
+}
+
+func (c *client) CreateReleaseLink(project, tagName string, link ReleaseLink) (*ReleaseLink, error) {
+	if c.legacyReleases() {
+		return nil, errLegacyReleases("linking assets")
+	}
+	link.ID = 0
+	created := &ReleaseLink{}
+	_, err := c.request(&request{
+		method:      http.MethodPost,
+		path:        releasePath(project, tagName) + "/assets/links",
+		requestBody: &link,
+		exitCodes:   []int{201},
+	}, created)
+	return created, err
+}
+
+// UpdateReleaseLink updates the link by its ID.
+func (c *client) UpdateReleaseLink(project, tagName string, link ReleaseLink) (*ReleaseLink, error) {
+	if c.legacyReleases() {
+		return nil, errLegacyReleases("linking assets")
+	}
+	path := fmt.Sprintf("%s/assets/links/%d", releasePath(project, tagName), link.ID)
+	link.ID = 0
+	updated := &ReleaseLink{}
+	_, err := c.request(&request{
+		method:      http.MethodPut,
+		path:        path,
+		requestBody: &link,
+		exitCodes:   []int{200},
+	}, updated)
+	return updated, err
+}
+
+// getTagRelease returns the release of the tag on GitLab before 11.7.
+func (c *client) getTagRelease(project, tagName string) (*Release, error) {
+	tag, err := c.GetTag(project, tagName)
+	if StatusCode(err) == http.StatusNotFound {
+		return nil, ErrReleaseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.Release == nil {
+		return nil, ErrReleaseNotFound
+	}
+	return &Release{TagName: tagName, Name: tagName, Description: tag.Release.Description}, nil
+}
+
+// createTagRelease creates the tag if it does not exist, and its release on GitLab before 11.7.
+func (c *client) createTagRelease(project string, req ReleaseRequest) (*Release, error) {
+	_, err := c.GetTag(project, req.TagName)
+	if StatusCode(err) == http.StatusNotFound {
+		err = c.CreateTag(project, TagRequest{TagName: req.TagName, Ref: req.Ref, Message: req.TagMessage})
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.warnLegacyFields(req.Name, req.Milestones, req.ReleasedAt)
+	if req.Assets != nil && len(req.Assets.Links) > 0 {
+		return nil, errLegacyReleases("linking assets")
+	}
+	return c.tagRelease(http.MethodPost, project, req.TagName, req.Description)
+}
+
+func (c *client) warnLegacyFields(name string, milestones []string, releasedAt *time.Time) {
+	if name != "" || len(milestones) > 0 || releasedAt != nil {
+		c.logger.Warn("The name, milestones and date of releases are ignored by GitLab before 11.7")
+	}
+}
+
+// tagRelease creates (POST) or updates (PUT) the release of the tag by the endpoint deprecated in GitLab 11.7.
+func (c *client) tagRelease(method, project, tagName, description string) (*Release, error) {
+	path := fmt.Sprintf(
+		"/projects/%s/repository/tags/%s/release",
+		url.PathEscape(project),
+		url.PathEscape(tagName),
+	)
+	values := url.Values{
+		"description": []string{description},
+	}
+	release := &Release{}
+	_, err := c.request(&request{
+		method:    method,
+		path:      path + "?" + values.Encode(),
+		exitCodes: []int{200, 201},
+	}, release)
+	release.Name = release.TagName
+	return release, err
+}
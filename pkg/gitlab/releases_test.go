@@ -0,0 +1,113 @@
+package gitlab_test
+
+import (
+	"net/http"
+	"testing"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
+)
+
+func TestReleases(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	client := s.Client()
+
+	if _, err := client.GetRelease("group/app", "v1.0.0"); err != gitlab.ErrReleaseNotFound {
+		t.Fatalf("got %v, want ErrReleaseNotFound", err)
+	}
+	if _, err := client.GetRelease("group/other", "v1.0.0"); gitlab.StatusCode(err) != http.StatusNotFound {
+		t.Fatalf("got %v for a missing project, want a 404 API error", err)
+	}
+	_, err := client.CreateRelease("group/app", gitlab.ReleaseRequest{
+		TagName:     "v1.0.0",
+		Ref:         "master",
+		Description: "first release",
+		Milestones:  []string{"1.0"},
+		Assets: &gitlab.ReleaseAssets{Links: []gitlab.ReleaseLink{
+			{Name: "walle-linux-amd64", URL: "https://example.com/walle-linux-amd64", LinkType: gitlab.LinkTypePackage},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetTag("group/app", "v1.0.0"); err != nil {
+		t.Errorf("the tag is not created: %v", err)
+	}
+
+	if _, err = client.UpdateRelease("group/app", "v1.0.0", gitlab.ReleaseUpdate{Name: "Walle 1.0", Description: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	release, err := client.GetRelease("group/app", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := release.Assets.Links[0]
+	link.URL = "https://example.com/v1.0.0/walle-linux-amd64"
+	if _, err = client.UpdateReleaseLink("group/app", "v1.0.0", link); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.CreateReleaseLink("group/app", "v1.0.0", gitlab.ReleaseLink{Name: "docs", URL: "https://example.com/docs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	release, err = client.GetRelease("group/app", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Name != "Walle 1.0" || release.Description != "updated" || len(release.Milestones) != 1 {
+		t.Errorf("got release %+v", release)
+	}
+	links := release.Assets.Links
+	if len(links) != 2 || links[0].URL != link.URL || links[0].LinkType != gitlab.LinkTypePackage || links[1].LinkType != gitlab.LinkTypeOther {
+		t.Errorf("got links %+v", links)
+	}
+
+	if releases, err := client.ListReleases("group/app"); err != nil || len(releases) != 1 || releases[0].TagName != "v1.0.0" {
+		t.Errorf("got releases %+v %v", releases, err)
+	}
+
+	// an empty description clears the release notes
+	if release, err = client.UpdateRelease("group/app", "v1.0.0", gitlab.ReleaseUpdate{}); err != nil {
+		t.Fatal(err)
+	}
+	if release.Name != "Walle 1.0" || release.Description != "" {
+		t.Errorf("got release %+v, want the description cleared only", release)
+	}
+	if err = client.DeleteRelease("group/app", "v1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.GetRelease("group/app", "v1.0.0"); err != gitlab.ErrReleaseNotFound {
+		t.Errorf("got %v after deleting, want ErrReleaseNotFound", err)
+	}
+}
+
+func TestLegacyReleases(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	s.Version.Version = "11.6.3-ee"
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	client := s.Client()
+
+	_, err := client.CreateRelease("group/app", gitlab.ReleaseRequest{TagName: "v1.0.0", Ref: "master", Description: "first release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.UpdateRelease("group/app", "v1.0.0", gitlab.ReleaseUpdate{Description: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	release, err := client.GetRelease("group/app", "v1.0.0")
+	if err != nil || release.Description != "updated" {
+		t.Errorf("got release %+v %v", release, err)
+	}
+	if releases, err := client.ListReleases("group/app"); err != nil || len(releases) != 1 {
+		t.Errorf("got releases %+v %v", releases, err)
+	}
+	if _, err = client.CreateReleaseLink("group/app", "v1.0.0", gitlab.ReleaseLink{Name: "docs", URL: "https://example.com"}); err == nil {
+		t.Error("links are not supported before GitLab 11.7")
+	}
+	if p.Releases()["v1.0.0"].Description != "updated" {
+		t.Errorf("got releases %+v on the server", p.Releases())
+	}
+}
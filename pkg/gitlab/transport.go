@@ -0,0 +1,107 @@
+package gitlab
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TransportConfig is implemented by configs which customize TLS and the proxy of the connections.
+type TransportConfig interface {
+	// GetCACert returns the path of a PEM bundle trusted in addition to the system roots.
+	GetCACert() string
+	// GetClientCert and GetClientKey return the paths of the PEM client certificate and key for mTLS.
+	GetClientCert() string
+	GetClientKey() string
+	// GetProxy returns the proxy URL, the proxy environment variables are used if it is empty.
+	GetProxy() string
+	GetInsecureSkipVerify() bool
+}
+
+// newHTTPClient returns a client which keeps connections alive between requests.
+func newHTTPClient(logger *logrus.Entry, cfg TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg == nil {
+		return &http.Client{Timeout: maxRequestTime, Transport: transport}, nil
+	}
+
+	if proxy := cfg.GetProxy(); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url %q: %v", proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{}
+	if caCert := cfg.GetCACert(); caCert != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		b, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certFile, keyFile := cfg.GetClientCert(), cfg.GetClientKey()
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("both client certificate and client key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cfg.GetInsecureSkipVerify() {
+		if logger != nil {
+			logger.Warn("TLS certificate verification is disabled, the connection to GitLab is NOT secure and the token may be stolen")
+		}
+		tlsConfig.InsecureSkipVerify = true
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Timeout: maxRequestTime, Transport: transport}, nil
+}
+
+// configError is not retried since the config will not change.
+type configError struct {
+	error
+}
+
+func (e *configError) Unwrap() error {
+	return e.error
+}
+
+// lazyHTTPClient builds the http client on the first request,
+// since the client is created before the flags are parsed.
+type lazyHTTPClient struct {
+	once   sync.Once
+	build  func() (*http.Client, error)
+	client *http.Client
+	err    error
+}
+
+func (l *lazyHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	l.once.Do(func() {
+		l.client, l.err = l.build()
+	})
+	if l.err != nil {
+		return nil, &configError{l.err}
+	}
+	return l.client.Do(req)
+}
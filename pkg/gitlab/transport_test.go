@@ -0,0 +1,129 @@
+package gitlab
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type transportConfig struct {
+	caCert, clientCert, clientKey, proxy string
+	insecure                             bool
+}
+
+func (c *transportConfig) GetCACert() string           { return c.caCert }
+func (c *transportConfig) GetClientCert() string       { return c.clientCert }
+func (c *transportConfig) GetClientKey() string        { return c.clientKey }
+func (c *transportConfig) GetProxy() string            { return c.proxy }
+func (c *transportConfig) GetInsecureSkipVerify() bool { return c.insecure }
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// clientCertificate returns a self-signed client certificate, and the paths of its PEM certificate and key.
+func clientCertificate(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "walle"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewTLSServer(ok)
+	defer server.Close()
+	caCert := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	cert, clientCert, clientKey := clientCertificate(t)
+	mtlsServer := httptest.NewUnstartedServer(ok)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+	mtlsCACert := writePEM(t, "mtls-ca.pem", "CERTIFICATE", mtlsServer.Certificate().Raw)
+
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer proxy.Close()
+
+	testcases := []struct {
+		name     string
+		cfg      *transportConfig
+		url      string
+		buildErr bool
+		reqErr   bool
+	}{
+		{name: "untrusted certificate", cfg: &transportConfig{}, url: server.URL, reqErr: true},
+		{name: "CA bundle", cfg: &transportConfig{caCert: caCert}, url: server.URL},
+		{name: "insecure", cfg: &transportConfig{insecure: true}, url: server.URL},
+		{name: "not a CA bundle", cfg: &transportConfig{caCert: clientKey}, buildErr: true},
+		{name: "missing client certificate", cfg: &transportConfig{caCert: mtlsCACert}, url: mtlsServer.URL, reqErr: true},
+		{name: "client certificate", cfg: &transportConfig{caCert: mtlsCACert, clientCert: clientCert, clientKey: clientKey}, url: mtlsServer.URL},
+		{name: "client certificate without key", cfg: &transportConfig{clientCert: clientCert}, buildErr: true},
+		{name: "proxy", cfg: &transportConfig{proxy: proxy.URL}, url: "http://gitlab.invalid/api/v4/version"},
+		{name: "invalid proxy", cfg: &transportConfig{proxy: "://proxy"}, buildErr: true},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := newHTTPClient(nil, tc.cfg)
+			if tc.buildErr || err != nil {
+				if !tc.buildErr || err == nil {
+					t.Fatalf("got error %v, want error %v", err, tc.buildErr)
+				}
+				return
+			}
+			resp, err := client.Get(tc.url)
+			if err == nil {
+				_ = resp.Body.Close()
+			}
+			if (err != nil) != tc.reqErr {
+				t.Fatalf("got error %v, want error %v", err, tc.reqErr)
+			}
+		})
+	}
+	if proxied != "http://gitlab.invalid/api/v4/version" {
+		t.Errorf("got proxied request %q", proxied)
+	}
+}
@@ -11,6 +11,8 @@ type User struct {
 	State     string
 	AvatarURL string
 	WebURL    string
+	// IsAdmin is only returned for the current user.
+	IsAdmin bool `json:"is_admin,omitempty"`
 }
 
 type MergeRequest struct {
@@ -31,21 +33,175 @@ type MergeRequest struct {
 	MergeStatus    string    `json:"merge_status"`
 	Author         User      `json:"author"`
 	MergeCommitSHA string    `json:"merge_commit_sha"`
+	// ClosingIssues are the issues closed when the merge request is merged, only fetched by GraphQL.
+	ClosingIssues []Issue `json:"-"`
+}
+
+type Issue struct {
+	IID    int    `json:"iid"`
+	Title  string `json:"title"`
+	WebURL string `json:"web_url"`
+}
+
+// MergeRequestWithChanges is a merge request and the files it changes.
+type MergeRequestWithChanges struct {
+	MergeRequest
+	Changes []MergeRequestChange
+}
+
+type MergeRequestChange struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	NewFile     bool   `json:"new_file"`
+	RenamedFile bool   `json:"renamed_file"`
+	DeletedFile bool   `json:"deleted_file"`
 }
 
 type Project struct {
-	ID            int      `json:"id"`
-	Description   string   `json:"description"`
-	DefaultBranch string   `json:"default_branch"`
-	Visibility    string   `json:"visibility"`
-	WebURL        string   `json:"web_url"`
-	TagList       []string `json:"tag_list"`
-	Owner         User     `json:"owner"`
+	ID                int                `json:"id"`
+	Name              string             `json:"name"`
+	PathWithNamespace string             `json:"path_with_namespace"`
+	Permissions       ProjectPermissions `json:"permissions"`
+	Description       string             `json:"description"`
+	DefaultBranch     string             `json:"default_branch"`
+	Visibility        string             `json:"visibility"`
+	WebURL            string             `json:"web_url"`
+	TagList           []string           `json:"tag_list"`
+	Owner             User               `json:"owner"`
+}
+
+// Access levels of members, https://docs.gitlab.com/ee/api/members.html#roles
+const (
+	NoAccess         = 0
+	GuestAccess      = 10
+	ReporterAccess   = 20
+	DeveloperAccess  = 30
+	MaintainerAccess = 40
+	OwnerAccess      = 50
+	AdminAccess      = 60
+)
+
+// AccessLevelName returns the role name of the access level.
+func AccessLevelName(level int) string {
+	switch level {
+	case NoAccess:
+		return "No access"
+	case GuestAccess:
+		return "Guest"
+	case ReporterAccess:
+		return "Reporter"
+	case DeveloperAccess:
+		return "Developer"
+	case MaintainerAccess:
+		return "Maintainer"
+	case OwnerAccess:
+		return "Owner"
+	case AdminAccess:
+		return "Admin"
+	}
+	return "Unknown"
+}
+
+type Access struct {
+	AccessLevel int `json:"access_level"`
+}
+
+type ProjectPermissions struct {
+	ProjectAccess *Access `json:"project_access"`
+	GroupAccess   *Access `json:"group_access"`
+}
+
+// AccessLevel returns the higher access level of the project and group membership.
+func (p ProjectPermissions) AccessLevel() int {
+	level := NoAccess
+	for _, a := range []*Access{p.ProjectAccess, p.GroupAccess} {
+		if a != nil && a.AccessLevel > level {
+			level = a.AccessLevel
+		}
+	}
+	return level
+}
+
+type AccessLevelRule struct {
+	AccessLevel            int    `json:"access_level"`
+	AccessLevelDescription string `json:"access_level_description"`
+	UserID                 int    `json:"user_id"`
+	GroupID                int    `json:"group_id"`
+}
+
+type ProtectedTag struct {
+	Name               string            `json:"name"`
+	CreateAccessLevels []AccessLevelRule `json:"create_access_levels"`
+}
+
+type ProtectedBranch struct {
+	Name              string            `json:"name"`
+	PushAccessLevels  []AccessLevelRule `json:"push_access_levels"`
+	MergeAccessLevels []AccessLevelRule `json:"merge_access_levels"`
+}
+
+type Version struct {
+	Version  string `json:"version"`
+	Revision string `json:"revision"`
+}
+
+type PersonalAccessToken struct {
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Revoked   bool     `json:"revoked"`
+	Active    bool     `json:"active"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt string   `json:"expires_at"`
 }
 
+// Release is a release of the Releases API, only TagName and Description are set in the release of tags.
 type Release struct {
-	TagName     string `json:"tag_name"`
-	Description string `json:"description"`
+	TagName     string        `json:"tag_name"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	ReleasedAt  time.Time     `json:"released_at"`
+	Milestones  []Milestone   `json:"milestones"`
+	Assets      ReleaseAssets `json:"assets"`
+}
+
+type Milestone struct {
+	ID     int    `json:"id"`
+	IID    int    `json:"iid"`
+	Title  string `json:"title"`
+	WebURL string `json:"web_url"`
+}
+
+type ReleaseAssets struct {
+	Links []ReleaseLink `json:"links"`
+}
+
+type ReleaseLink struct {
+	ID       int    `json:"id,omitempty"`
+	Name     string `json:"name"`
+	URL      string `json:"url"`
+	LinkType string `json:"link_type,omitempty"`
+}
+
+// ReleaseRequest creates a release, the tag is created from Ref if it does not exist.
+type ReleaseRequest struct {
+	TagName     string         `json:"tag_name,omitempty"`
+	Ref         string         `json:"ref,omitempty"`
+	TagMessage  string         `json:"tag_message,omitempty"`
+	Name        string         `json:"name,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Milestones  []string       `json:"milestones,omitempty"`
+	ReleasedAt  *time.Time     `json:"released_at,omitempty"`
+	Assets      *ReleaseAssets `json:"assets,omitempty"`
+}
+
+// ReleaseUpdate updates a release. The description is always sent, an empty one clears the release notes,
+// the other empty fields are not changed.
+type ReleaseUpdate struct {
+	Name        string     `json:"name,omitempty"`
+	Description string     `json:"description"`
+	Milestones  []string   `json:"milestones,omitempty"`
+	ReleasedAt  *time.Time `json:"released_at,omitempty"`
 }
 
 type Commit struct {
@@ -72,10 +228,9 @@ type Tag struct {
 }
 
 type TagRequest struct {
-	TagName            string `json:"tag_name"`
-	Ref                string `json:"ref"`
-	Message            string `json:"message"`
-	ReleaseDescription string `json:"release_description"`
+	TagName string `json:"tag_name"`
+	Ref     string `json:"ref"`
+	Message string `json:"message"`
 }
 
 type RepoFileRequest struct {
@@ -85,6 +240,70 @@ type RepoFileRequest struct {
 	Content       string `json:"content"`
 }
 
+type RepoFile struct {
+	FileName     string `json:"file_name"`
+	FilePath     string `json:"file_path"`
+	Ref          string `json:"ref"`
+	BlobID       string `json:"blob_id"`
+	CommitID     string `json:"commit_id"`
+	LastCommitID string `json:"last_commit_id"`
+	Encoding     string `json:"encoding"`
+	Content      string `json:"content"`
+}
+
+const (
+	CommitActionCreate = "create"
+	CommitActionUpdate = "update"
+	CommitActionDelete = "delete"
+	CommitActionMove   = "move"
+)
+
+type CommitAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	// PreviousPath is the original path of a moved file.
+	PreviousPath string `json:"previous_path,omitempty"`
+	Content      string `json:"content,omitempty"`
+	Encoding     string `json:"encoding,omitempty"`
+	// LastCommitID makes the commit fail if the file has been changed after this commit.
+	LastCommitID string `json:"last_commit_id,omitempty"`
+}
+
+type CommitRequest struct {
+	Branch        string         `json:"branch"`
+	CommitMessage string         `json:"commit_message"`
+	Actions       []CommitAction `json:"actions"`
+	// StartBranch creates Branch from it when Branch does not exist.
+	StartBranch string `json:"start_branch,omitempty"`
+	// StartSHA creates Branch from the commit when Branch does not exist.
+	StartSHA    string `json:"start_sha,omitempty"`
+	AuthorEmail string `json:"author_email,omitempty"`
+	AuthorName  string `json:"author_name,omitempty"`
+	// Force overwrites Branch with a new commit based on StartBranch or StartSHA.
+	Force bool `json:"force,omitempty"`
+}
+
+type Branch struct {
+	Name      string `json:"name"`
+	Merged    bool   `json:"merged"`
+	Protected bool   `json:"protected"`
+	Default   bool   `json:"default"`
+	Commit    Commit `json:"commit"`
+	WebURL    string `json:"web_url"`
+}
+
+type MergeRequestQuery struct {
+	State        string `json:"state,omitempty"`
+	SourceBranch string `json:"source_branch,omitempty"`
+	TargetBranch string `json:"target_branch,omitempty"`
+}
+
+type MergeRequestUpdate struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	AssigneeID  int    `json:"assignee_id,omitempty"`
+}
+
 type MergeRequestRequest struct {
 	SourceBranch       string `json:"source_branch"`
 	TargetBranch       string `json:"target_branch"`
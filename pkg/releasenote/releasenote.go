@@ -1,7 +1,9 @@
 package releasenote
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
@@ -27,7 +29,10 @@ const (
 
 var (
 	tagMatcherRe = regexp.MustCompile(`^([^( ]+)\((.*)\)$`)
-	kinds        = map[string]string{
+	// mergeRequestRe matches the trailer GitLab adds to merge commits, e.g. `See merge request group/app!12`.
+	// The project path is not compared, merge commits made before the project was renamed or transferred name the old one.
+	mergeRequestRe = regexp.MustCompile(`\n\nSee merge request .+!(\d+)$`)
+	kinds          = map[string]string{
 		"feat":     titleNewFeature,
 		"fix":      titleBugFix,
 		"refactor": titleChanges,
@@ -129,93 +134,285 @@ func generateReleaseNotes(mrs []*gitlab.MergeRequest, condition func(mr *gitlab.
 	return joinNotes(titles)
 }
 
-func GetReleaseNotesByTag(client gitlab.Client, project, tagName, ref string) (
-	tagExists bool, releaseNotes string, err error,
+// Scope limits release notes to a component of a monorepo.
+// The zero value covers the whole repository.
+type Scope struct {
+	// TagPrefix restricts the tags used to find the previous release.
+	TagPrefix string
+	// ExcludeTagPrefixes are the tag prefixes of the other components, their tags are never the previous release,
+	// e.g. `api/v1.0.0` of a monorepo is not the release before `v1.1.0` of the whole repository.
+	ExcludeTagPrefixes []string
+	// Paths are glob patterns, only MRs changing any of them are included.
+	Paths []string
+}
+
+func (s Scope) matchTag(name string) bool {
+	if !strings.HasPrefix(name, s.TagPrefix) {
+		return false
+	}
+	for _, prefix := range s.ExcludeTagPrefixes {
+		// a longer prefix of another component wins, e.g. `api/v2/` over `api/`
+		if len(prefix) > len(s.TagPrefix) && strings.HasPrefix(name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchChanges reports whether any of the changed files belong to the scope.
+func (s Scope) matchChanges(changes []gitlab.MergeRequestChange) bool {
+	for _, change := range changes {
+		if utils.MatchAnyPath(s.Paths, change.NewPath) || utils.MatchAnyPath(s.Paths, change.OldPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// Options controls how release notes are generated.
+type Options struct {
+	Scope Scope
+	// Workers is the number of merge requests requested concurrently when GraphQL is unavailable, 4 by default.
+	Workers int
+	// Strict fails if any merge request can not be fetched, instead of leaving it out of the release notes.
+	Strict bool
+	// Progress is called with the number of merge requests fetched so far, if it is not nil. Calls are serialized.
+	Progress func(done, total int)
+}
+
+// Result is the release notes and the merge requests left out of them.
+type Result struct {
+	Notes string
+	// Missing are the IIDs of the merge requests which could not be fetched, in the order of commits.
+	Missing []int
+}
+
+// MissingMergeRequestsError is returned by strict options if any merge request can not be fetched.
+type MissingMergeRequestsError struct {
+	IIDs []int
+}
+
+func (e *MissingMergeRequestsError) Error() string {
+	return "failed to get merge requests " + FormatIIDs(e.IIDs)
+}
+
+// FormatIIDs formats the merge requests like `!1, !2`.
+func FormatIIDs(iids []int) string {
+	refs := make([]string, len(iids))
+	for i, iid := range iids {
+		refs[i] = "!" + strconv.Itoa(iid)
+	}
+	return strings.Join(refs, ", ")
+}
+
+func GetReleaseNotesByTag(client gitlab.Client, project, tagName, ref string, opts Options) (
+	tagExists bool, result Result, err error,
 ) {
-	tags, err := client.ListTags(project)
-	if err != nil {
+	scope := opts.Scope
+	if !scope.matchTag(tagName) {
+		err = fmt.Errorf("tag %s does not start with the prefix %s", tagName, scope.TagPrefix)
 		return
 	}
 	var sinceAt, untilAt *time.Time
-
-	for i := 0; i < len(tags); i++ {
-		tag := tags[i]
-		if tag.Name == tagName {
-			tagExists = true
-			untilAt = &tag.Commit.CreatedAt
-			continue
+	// tags are listed from the newest, stop at the tag before this
+	err = client.WalkTags(project, gitlab.ListOptions{}, func(tags []gitlab.Tag, _ gitlab.Page) bool {
+		for i := 0; i < len(tags); i++ {
+			tag := tags[i]
+			if !scope.matchTag(tag.Name) {
+				continue
+			}
+			if tag.Name == tagName {
+				tagExists = true
+				untilAt = &tag.Commit.CreatedAt
+				continue
+			}
+			sinceAt = &tag.Commit.CreatedAt
+			return false
 		}
-		sinceAt = &tag.Commit.CreatedAt
-		break
+		return true
+	})
+	if err != nil {
+		return
 	}
 
+	result, err = releaseNotesBetween(client, project, ref, sinceAt, untilAt, opts)
+	return
+}
+
+// GetReleaseNotesBetween returns the release notes of the tag since the previous tag,
+// previous is nil if it is the first tag.
+func GetReleaseNotesBetween(client gitlab.Client, project string, previous, tag *gitlab.Tag, opts Options) (Result, error) {
+	var sinceAt *time.Time
+	if previous != nil {
+		sinceAt = &previous.Commit.CreatedAt
+	}
+	return releaseNotesBetween(client, project, tag.Name, sinceAt, &tag.Commit.CreatedAt, opts)
+}
+
+func releaseNotesBetween(client gitlab.Client, project, ref string, sinceAt, untilAt *time.Time, opts Options) (Result, error) {
 	commits, err := client.ListCommits(project, ref, sinceAt, untilAt)
 	if err != nil {
 		logrus.Errorf("An error occurred while list commits. %v", err)
-		return
+		return Result{}, err
 	}
 	if len(commits) > 0 {
 		// the first commit belong to the tag before this
 		commits = commits[1:]
 	}
 
-	mrs := mrFromCommits(commits, client, project)
+	mrs, missing, err := mrFromCommits(commits, client, project, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	if len(missing) > 0 && opts.Strict {
+		return Result{}, &MissingMergeRequestsError{IIDs: missing}
+	}
 
 	condition := func(mr *gitlab.MergeRequest) bool {
 		// do not have the label `release-note-none`
 		exclude := MatchesExcludeFilter(mr.Description) || utils.InStringArray(labelReleaseNoteNone, mr.Labels)
 		return !exclude
 	}
-	releaseNotes = generateReleaseNotes(mrs, condition)
-	return
+	return Result{Notes: generateReleaseNotes(mrs, condition), Missing: missing}, nil
+}
+
+// mrFromCommits returns the merge requests of the scope merged by the commits,
+// and the IIDs of the merge requests which could not be fetched.
+func mrFromCommits(commits []*gitlab.Commit, client gitlab.Client, project string, opts Options) ([]*gitlab.MergeRequest, []int, error) {
+	var iids []int
+	for _, commit := range commits {
+		if iid := mrNumForCommitFromMessage(commit.Message); iid != 0 {
+			iids = append(iids, iid)
+		}
+	}
+	if len(iids) == 0 {
+		return nil, nil, nil
+	}
+
+	// GraphQL fetches the merge requests in a few queries, it is unavailable e.g. for job tokens
+	result, missing, err := mrFromGraphQL(iids, client, project, opts)
+	if err == nil {
+		return result, missing, nil
+	}
+	if !graphQLUnavailable(err) {
+		return nil, nil, fmt.Errorf("get merge requests by GraphQL: %w", err)
+	}
+	logrus.Warnf("GraphQL is unavailable, getting %d merge requests one by one from the REST API. %v", len(iids), err)
+	result, missing = mrFromREST(iids, client, project, opts)
+	return result, missing, nil
+}
+
+// graphQLUnavailable reports whether GraphQL can not be used with the token or the GitLab instance,
+// e.g. job tokens are unauthorized and older versions miss fields of the query.
+// Other errors, e.g. server errors left after retries, are not worth retrying with many REST requests.
+func graphQLUnavailable(err error) bool {
+	switch gitlab.StatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	var graphQLErr *gitlab.GraphQLError
+	return errors.As(err, &graphQLErr)
 }
 
-func mrFromCommits(commits []*gitlab.Commit, client gitlab.Client, project string) (result []*gitlab.MergeRequest) {
+func mrFromGraphQL(iids []int, client gitlab.Client, project string, opts Options) ([]*gitlab.MergeRequest, []int, error) {
+	scope := opts.Scope
+	mrs, err := client.ListMergeRequestsByIID(project, iids, len(scope.Paths) > 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	found := make(map[int]bool, len(mrs))
+	var result []*gitlab.MergeRequest
+	for i := range mrs {
+		found[mrs[i].IID] = true
+		if len(scope.Paths) > 0 && !scope.matchChanges(mrs[i].Changes) {
+			continue
+		}
+		result = append(result, &mrs[i].MergeRequest)
+	}
+	var missing []int
+	for _, iid := range iids {
+		if !found[iid] {
+			logrus.Warnf("merge request %d is not found", iid)
+			missing = append(missing, iid)
+		}
+	}
+	if opts.Progress != nil {
+		opts.Progress(len(iids), len(iids))
+	}
+	return result, missing, nil
+}
+
+func mrFromREST(iids []int, client gitlab.Client, project string, opts Options) (result []*gitlab.MergeRequest, missing []int) {
+	scope := opts.Scope
 	var lock sync.Mutex
-	maxWorkerCount := defaultWorkerCount
-	if maxWorkerCount > len(commits) {
-		maxWorkerCount = len(commits)
+	failed := make(map[int]bool)
+	var done int
+	maxWorkerCount := opts.Workers
+	if maxWorkerCount <= 0 {
+		maxWorkerCount = defaultWorkerCount
 	}
-	if maxWorkerCount == 0 {
-		return
+	if maxWorkerCount > len(iids) {
+		maxWorkerCount = len(iids)
 	}
 	c := make(chan int, maxWorkerCount)
 	var wg sync.WaitGroup
 	wg.Add(maxWorkerCount)
 
+	fetch := func(iid int) (*gitlab.MergeRequest, error) {
+		mr, err := client.GetMergeRequest(project, iid)
+		if err != nil {
+			logrus.Warnf("an error occurred while get merge request %d. %s", iid, err)
+			return nil, err
+		}
+		if len(scope.Paths) > 0 {
+			changes, err := client.GetMergeRequestChanges(project, iid)
+			if err != nil {
+				logrus.Warnf("an error occurred while get changes of merge request %d. %s", iid, err)
+				return nil, err
+			}
+			if !scope.matchChanges(changes) {
+				return nil, nil
+			}
+		}
+		return mr, nil
+	}
 	for i := 0; i < maxWorkerCount; i++ {
 		go func() {
 			defer wg.Done()
 			for iid := range c {
-				mr, err := client.GetMergeRequest(project, iid)
+				mr, err := fetch(iid)
+				lock.Lock()
 				if err != nil {
-					logrus.Warnf("an error occurred while get merge request %d. %s", iid, err)
-					continue
+					failed[iid] = true
+				} else if mr != nil {
+					result = append(result, mr)
+				}
+				done++
+				if opts.Progress != nil {
+					opts.Progress(done, len(iids))
 				}
-				lock.Lock()
-				result = append(result, mr)
 				lock.Unlock()
 			}
 		}()
 	}
 
-	for _, commit := range commits {
-		iid := mrNumForCommitFromMessage(commit.Message)
-		if iid == 0 {
-			continue
-		}
+	for _, iid := range iids {
 		c <- iid
 	}
 
 	close(c)
 	wg.Wait()
 
+	for _, iid := range iids {
+		if failed[iid] {
+			missing = append(missing, iid)
+		}
+	}
 	return
 }
 
 func mrNumForCommitFromMessage(commitMessage string) (mr int) {
-	regex := regexp.MustCompile(`\n\nSee merge request .+!(\d+)$`)
-	match := regex.FindStringSubmatch(commitMessage)
+	match := mergeRequestRe.FindStringSubmatch(commitMessage)
 	if match == nil || len(match) < 2 {
 		return 0
 	}
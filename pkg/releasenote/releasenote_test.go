@@ -2,7 +2,12 @@ package releasenote
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
+
+	"walle/pkg/gitlab"
+	"walle/pkg/gitlab/gitlabtest"
 )
 
 func TestGenerateReleaseNotes(t *testing.T) {
@@ -29,3 +34,164 @@ func TestGenerateReleaseNotes(t *testing.T) {
 		}
 	}
 }
+
+func TestGetReleaseNotesByTag(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Merge(gitlab.MergeRequest{Title: "feat: first feature"}, map[string]string{"api/a.go": "a"})
+	p.Commit("master", "chore: release api/v1.0.0", nil)
+	p.Tag("api/v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "fix(api): fix api"}, map[string]string{"api/b.go": "b"})
+	p.Merge(gitlab.MergeRequest{Title: "feat: web feature"}, map[string]string{"web/c.js": "c"})
+	p.Merge(gitlab.MergeRequest{Title: "docs: skipped", Labels: []string{labelReleaseNoteNone}}, map[string]string{"api/d.md": "d"})
+	p.Commit("master", "chore: prepare api/v1.1.0", nil)
+	s.MaxPerPage = 2
+	expected := "**Bug Fix:**\n- api: fix api ([!2](" + p.Info().WebURL + "/-/merge_requests/2)) @root\n"
+
+	for _, graphQL := range []bool{true, false} {
+		if !graphQL {
+			// e.g. job tokens can not use GraphQL
+			s.Fail(http.MethodPost, "/api/graphql", http.StatusUnauthorized, -1)
+		}
+		s.ResetRequests()
+		exists, result, err := GetReleaseNotesByTag(s.Client(), "group/app", "api/v1.1.0", "master",
+			Options{Scope: Scope{TagPrefix: "api/", Paths: []string{"api/**"}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("api/v1.1.0 should not exist")
+		}
+		if result.Notes != expected || len(result.Missing) > 0 {
+			t.Errorf("graphql %v: got release notes \n%s, missing %v, want \n%s", graphQL, result.Notes, result.Missing, expected)
+		}
+
+		var rest int
+		for _, req := range s.Requests() {
+			if strings.Contains(req, "/merge_requests/") {
+				rest++
+			}
+		}
+		if graphQL && rest != 0 || !graphQL && rest == 0 {
+			t.Errorf("graphql %v: got %d REST requests of merge requests", graphQL, rest)
+		}
+	}
+}
+
+func TestGetReleaseNotesByTagSkipsComponentTags(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Merge(gitlab.MergeRequest{Title: "feat: first feature"}, map[string]string{"a.go": "a"})
+	p.Commit("master", "chore: release v1.0.0", nil)
+	p.Tag("v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "feat: second feature"}, map[string]string{"b.go": "b"})
+	p.Commit("master", "chore: release api/v1.0.0", nil)
+	p.Tag("api/v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "fix: a bug"}, map[string]string{"a.go": "fixed"})
+	p.Commit("master", "chore: prepare v1.1.0", nil)
+
+	// the tag of the api component is not the release before v1.1.0 of the whole repository
+	_, result, err := GetReleaseNotesByTag(s.Client(), "group/app", "v1.1.0", "master",
+		Options{Scope: Scope{ExcludeTagPrefixes: []string{"api/"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Notes, "second feature") || !strings.Contains(result.Notes, "a bug") ||
+		strings.Contains(result.Notes, "first feature") {
+		t.Errorf("got release notes\n%s\nwant the changes since v1.0.0", result.Notes)
+	}
+}
+
+func TestGraphQLServerError(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Tag("v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "feat: first"}, nil)
+	p.Commit("master", "chore: prepare v1.1.0", nil)
+	s.Fail(http.MethodPost, "/api/graphql", http.StatusInternalServerError, -1)
+
+	// an outage of GraphQL fails instead of requesting every merge request
+	if _, _, err := GetReleaseNotesByTag(s.Client(), "group/app", "v1.1.0", "master", Options{}); gitlab.StatusCode(err) != http.StatusInternalServerError {
+		t.Errorf("got %v, want the GraphQL error", err)
+	}
+	for _, req := range s.Requests() {
+		if strings.Contains(req, "/merge_requests/") {
+			t.Errorf("got %s, want no fallback to the REST API", req)
+		}
+	}
+}
+
+func TestMissingMergeRequests(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "group/app"})
+	p.Tag("v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "feat: first"}, nil)
+	p.Merge(gitlab.MergeRequest{Title: "fix: second"}, nil)
+	p.Commit("master", "chore: prepare v1.1.0", nil)
+	s.Fail(http.MethodPost, "/api/graphql", http.StatusUnauthorized, -1)
+	s.Fail(http.MethodGet, "/projects/group/app/merge_requests/2", http.StatusNotFound, -1)
+
+	var progress []int
+	_, result, err := GetReleaseNotesByTag(s.Client(), "group/app", "v1.1.0", "master", Options{
+		Workers:  1,
+		Progress: func(done, total int) { progress = append(progress, done, total) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Notes, "first") || strings.Contains(result.Notes, "second") {
+		t.Errorf("got release notes \n%s", result.Notes)
+	}
+	if fmt.Sprint(result.Missing) != "[2]" {
+		t.Errorf("got missing merge requests %v, want [2]", result.Missing)
+	}
+	if fmt.Sprint(progress) != "[1 2 2 2]" {
+		t.Errorf("got progress %v, want [1 2 2 2]", progress)
+	}
+
+	_, _, err = GetReleaseNotesByTag(s.Client(), "group/app", "v1.1.0", "master", Options{Strict: true})
+	if e, ok := err.(*MissingMergeRequestsError); !ok || fmt.Sprint(e.IIDs) != "[2]" {
+		t.Errorf("got error %v, want missing !2", err)
+	}
+}
+
+func TestGetReleaseNotesOfMovedProject(t *testing.T) {
+	s := gitlabtest.NewServer()
+	defer s.Close()
+	p := s.AddProject(gitlab.Project{PathWithNamespace: "old-group/app"})
+	p.Tag("v1.0.0", "master")
+	p.Merge(gitlab.MergeRequest{Title: "feat: before the move"}, nil)
+	p.Move("group/app")
+	p.Merge(gitlab.MergeRequest{Title: "fix: after the move"}, nil)
+	p.Commit("master", "chore: prepare v1.1.0", nil)
+
+	// the merge commit before the move says `See merge request old-group/app!1`
+	_, result, err := GetReleaseNotesByTag(s.Client(), "group/app", "v1.1.0", "master", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(result.Notes, "before the move") || !strings.Contains(result.Notes, "after the move") {
+		t.Errorf("got release notes\n%s\nwant the merge requests before and after the move", result.Notes)
+	}
+}
+
+func TestMrNumForCommitFromMessage(t *testing.T) {
+	testcases := []struct {
+		message string
+		want    int
+	}{
+		{message: "Merge branch 'a' into 'master'\n\nfeat: a\n\nSee merge request group/app!12", want: 12},
+		// merge commits made before the project was renamed or transferred name the old path
+		{message: "Merge branch 'a' into 'master'\n\nSee merge request old-group/app!12", want: 12},
+		{message: "fix: a", want: 0},
+	}
+	for _, tc := range testcases {
+		if got := mrNumForCommitFromMessage(tc.message); got != tc.want {
+			t.Errorf("mrNumForCommitFromMessage(%q) = %d, want %d", tc.message, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	testcases := []struct {
+		s    string
+		want Version
+		ok   bool
+	}{
+		{s: "1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}, ok: true},
+		{s: "v1.2.3", want: Version{Major: 1, Minor: 2, Patch: 3}, ok: true},
+		{s: "v1.2", want: Version{Major: 1, Minor: 2}, ok: true},
+		{s: "v1", want: Version{Major: 1}, ok: true},
+		{s: "v1.2.3-rc.1", want: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1"}, ok: true},
+		{s: "v1.2.3+build.5", want: Version{Major: 1, Minor: 2, Patch: 3}, ok: true},
+		{s: "v1.2.3-beta+exp.sha.5114f85", want: Version{Major: 1, Minor: 2, Patch: 3, Prerelease: "beta"}, ok: true},
+		// GitLab versions have the edition as a suffix
+		{s: "11.6.3-ee", want: Version{Major: 11, Minor: 6, Patch: 3, Prerelease: "ee"}, ok: true},
+		{s: "V1.2.3"},
+		{s: "1.2.3.4"},
+		{s: "v1.2.3-"},
+		{s: "v1.2.3+"},
+		{s: "api/v1.2.3"},
+		{s: "release"},
+		{s: ""},
+	}
+	for _, tc := range testcases {
+		got, ok := Parse(tc.s)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v, %v", tc.s, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "v1.2.3", b: "v1.2.3", want: 0},
+		{a: "v1.2.3", b: "1.2.3", want: 0},
+		{a: "v1.2", b: "v1.2.0", want: 0},
+		{a: "v1.2.3+build.1", b: "v1.2.3+build.2", want: 0},
+		{a: "v1.2.3", b: "v1.2.4", want: -1},
+		{a: "v1.3.0", b: "v1.2.9", want: 1},
+		{a: "v2.0.0", b: "v1.99.99", want: 1},
+		{a: "v1.10.0", b: "v1.9.0", want: 1},
+		{a: "v1.0.0-rc.1", b: "v1.0.0", want: -1},
+		{a: "v1.0.0-alpha", b: "v1.0.0-alpha.1", want: -1},
+		{a: "v1.0.0-alpha.1", b: "v1.0.0-alpha.beta", want: -1},
+		{a: "v1.0.0-beta.2", b: "v1.0.0-beta.11", want: -1},
+		{a: "v1.0.0-beta.11", b: "v1.0.0-rc.1", want: -1},
+		{a: "11.6.3-ee", b: "11.6.3", want: -1},
+		{a: "11.6.3-ee", b: "11.6.2", want: 1},
+		{a: "11.6.3-ce", b: "11.6.3-ee", want: -1},
+	}
+	for _, tc := range testcases {
+		a, okA := Parse(tc.a)
+		b, okB := Parse(tc.b)
+		if !okA || !okB {
+			t.Fatalf("failed to parse %q or %q", tc.a, tc.b)
+		}
+		if got := Compare(a, b); got != tc.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := Compare(b, a); got != -tc.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestLess(t *testing.T) {
+	testcases := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "v1.0.0", b: "v1.0.1", want: true},
+		{a: "v1.0.1", b: "v1.0.0"},
+		{a: "release", b: "v1.0.0", want: true},
+		{a: "v1.0.0", b: "release"},
+		{a: "release", b: "latest"},
+	}
+	for _, tc := range testcases {
+		if got := Less(tc.a, tc.b); got != tc.want {
+			t.Errorf("Less(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchPath reports whether the slash separated file name matches the glob pattern.
+// Besides the syntax of path.Match, a `**` element matches zero or more directories,
+// and a pattern ending with `/` matches everything under the directory.
+func MatchPath(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	name = strings.TrimPrefix(name, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchElems(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			if len(rest) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchElems(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// MatchAnyPath reports whether the file name matches one of the patterns.
+func MatchAnyPath(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if MatchPath(p, name) {
+			return true
+		}
+	}
+	return false
+}
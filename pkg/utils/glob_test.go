@@ -0,0 +1,57 @@
+package utils
+
+import "testing"
+
+func TestMatchPath(t *testing.T) {
+	testcases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// exact
+		{pattern: "go.mod", name: "go.mod", want: true},
+		{pattern: "services/api/main.go", name: "services/api/main.go", want: true},
+		{pattern: "/services/api/main.go", name: "services/api/main.go", want: true},
+		{pattern: "services/api/main.go", name: "services/api/main_test.go"},
+		{pattern: "go.mod", name: "tools/go.mod"},
+		// `*` does not cross `/`
+		{pattern: "services/*", name: "services/api", want: true},
+		{pattern: "services/*", name: "services/api/main.go"},
+		{pattern: "*.go", name: "main.go", want: true},
+		{pattern: "*.go", name: "cmd/main.go"},
+		{pattern: "services/*/main.go", name: "services/api/main.go", want: true},
+		{pattern: "services/*/main.go", name: "services/api/cmd/main.go"},
+		// `**` at the start
+		{pattern: "**/main.go", name: "main.go", want: true},
+		{pattern: "**/main.go", name: "services/api/main.go", want: true},
+		{pattern: "**/main.go", name: "services/api/main_test.go"},
+		// `**` in the middle
+		{pattern: "services/**/main.go", name: "services/main.go", want: true},
+		{pattern: "services/**/main.go", name: "services/api/cmd/main.go", want: true},
+		{pattern: "services/**/main.go", name: "web/api/main.go"},
+		{pattern: "services/**/*.go", name: "services/api/handler.go", want: true},
+		// `**` at the end, and a trailing `/`
+		{pattern: "services/api/**", name: "services/api/cmd/main.go", want: true},
+		{pattern: "services/api/**", name: "services/api", want: true},
+		{pattern: "services/api/**", name: "services/apigw/main.go"},
+		{pattern: "libs/", name: "libs/log/log.go", want: true},
+		{pattern: "libs/", name: "libsx/log.go"},
+		// invalid patterns match nothing
+		{pattern: "services/[", name: "services/["},
+	}
+	for _, tc := range testcases {
+		if got := MatchPath(tc.pattern, tc.name); got != tc.want {
+			t.Errorf("MatchPath(%q, %q) = %v, want %v", tc.pattern, tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMatchAnyPath(t *testing.T) {
+	patterns := []string{"services/api/**", "libs/"}
+	if !MatchAnyPath(patterns, "libs/log.go") {
+		t.Error("got no match of libs/log.go")
+	}
+	if MatchAnyPath(patterns, "web/index.js") || MatchAnyPath(nil, "web/index.js") {
+		t.Error("got a match of web/index.js")
+	}
+}